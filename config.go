@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFile is the name of the project-wide configuration file. The one
+// nearest to a package, up to its module root, configures it.
+const configFile = ".genopts.yaml"
+
+// Config holds the generator settings of a package: the defaults, overridden
+// by the nearest .genopts.yaml, overridden by the flags set on the command
+// line. The directives of a struct override them for the struct.
+type Config struct {
+	// Prefix and Suffix surround the field name in option names, as in
+	// WithName. Directives: //genopts:prefix=... and //genopts:suffix=...
+	Prefix string `yaml:"prefix"`
+	Suffix string `yaml:"suffix"`
+	// Collisions says what to do when an option name is taken by another
+	// struct of the package: "prefix" it with the struct name, as in
+	// User_WithName, or report an "error".
+	Collisions string `yaml:"collisions"`
+	// Aggregate makes options report all their errors joined. Directive:
+	// //genopts:aggregate
+	Aggregate bool `yaml:"aggregate"`
+	// Flags adds a Register<Struct>Flags function that binds the options of
+	// a struct to a flag.FlagSet. Directive: //genopts:flags
+	Flags bool `yaml:"flags"`
+	// Decode lists the formats of the config documents, json and yaml,
+	// that <Struct>OptionsFromJSON and <Struct>OptionsFromYAML decode
+	// options from. Directive: //genopts:decode=json,yaml
+	Decode []string `yaml:"decode"`
+	// Immutable adds value methods that return a modified copy of a struct,
+	// as in u.WithName("x"). Directive: //genopts:immutable
+	Immutable bool `yaml:"immutable"`
+	// Builder adds a builder type that collects the options of a struct.
+	// Directive: //genopts:builder
+	Builder bool `yaml:"builder"`
+	// OutputSuffix replaces the .go extension of source files in the names
+	// of the files generated for them.
+	OutputSuffix string `yaml:"output_suffix"`
+	// Tag is the struct tag key of the options.
+	Tag string `yaml:"tag"`
+	// Header is written as a comment at the top of every generated file.
+	Header string `yaml:"header"`
+	// Initialisms are spelled in all caps in option names, in addition to
+	// the common ones.
+	Initialisms []string `yaml:"initialisms"`
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Prefix:       "With",
+		Collisions:   "prefix",
+		OutputSuffix: ".gen.go",
+		Tag:          "with",
+	}
+}
+
+// loadConfig returns the configuration of the package in dir.
+func loadConfig(dir string) (*Config, error) {
+	cfg := defaultConfig()
+	path, err := findConfig(dir)
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		if err := cfg.decode(path); err != nil {
+			return nil, err
+		}
+	}
+
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "name-prefix":
+			cfg.Prefix = *namePrefix
+		case "name-suffix":
+			cfg.Suffix = *nameSuffix
+		case "collisions":
+			cfg.Collisions = *collisions
+		case "aggregate":
+			cfg.Aggregate = *aggregate
+		case "flags":
+			cfg.Flags = *flags
+		case "decode":
+			cfg.Decode = strings.Split(*decode, ",")
+		case "immutable":
+			cfg.Immutable = *immutable
+		case "builder":
+			cfg.Builder = *builder
+		case "suffix":
+			cfg.OutputSuffix = *outputSuffix
+		case "tag":
+			cfg.Tag = *tagKey
+		case "header":
+			cfg.Header = *header
+		case "initialisms":
+			cfg.Initialisms = append(cfg.Initialisms, strings.Split(*initialism, ",")...)
+		}
+	})
+
+	if err := cfg.validate(); err != nil {
+		if path != "" {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// findConfig returns the path of the configuration file nearest to dir, or
+// "" when there is none up to the module root.
+func findConfig(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, configFile)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return "", nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// decode overrides the settings of cfg with the ones the file at path sets.
+// Unknown settings are errors.
+func (cfg *Config) decode(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func (cfg *Config) validate() error {
+	if cfg.Prefix+cfg.Suffix != "" && !token.IsIdentifier(cfg.Prefix+"X"+cfg.Suffix) {
+		return fmt.Errorf("prefix %q and suffix %q do not make identifiers", cfg.Prefix, cfg.Suffix)
+	}
+	if cfg.Collisions != "prefix" && cfg.Collisions != "error" {
+		return fmt.Errorf("collisions must be prefix or error, not %q", cfg.Collisions)
+	}
+	if !strings.HasSuffix(cfg.OutputSuffix, ".go") || strings.HasSuffix(cfg.OutputSuffix, "_test.go") || strings.ContainsRune(cfg.OutputSuffix, filepath.Separator) {
+		return fmt.Errorf("output suffix %q does not name Go source files", cfg.OutputSuffix)
+	}
+	formats, err := parseFormats(strings.Join(cfg.Decode, ","))
+	if err != nil {
+		return err
+	}
+	cfg.Decode = formats
+	if cfg.Tag == "" || strings.ContainsAny(cfg.Tag, " :\"\x7f") {
+		return fmt.Errorf("invalid tag key %q", cfg.Tag)
+	}
+	return nil
+}
+
+// output returns the path of the file generated for the source file at
+// path.
+func (cfg *Config) output(path string) string {
+	return strings.TrimSuffix(path, ".go") + cfg.OutputSuffix
+}
+
+// packageOutput returns the path of the file that holds the declarations
+// shared by the generated code of the package in dir, such as RuleError.
+// With -per-package it holds all the generated code of the package.
+func (cfg *Config) packageOutput(dir string) string {
+	return filepath.Join(dir, "genopts"+cfg.OutputSuffix)
+}
+
+// headerComment returns Header as comment lines.
+func (cfg *Config) headerComment() string {
+	if cfg.Header == "" {
+		return ""
+	}
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(cfg.Header, "\n"), "\n") {
+		b.WriteString(strings.TrimRight("// "+line, " ") + "\n")
+	}
+	return b.String()
+}
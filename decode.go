@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// The formats of the config documents options can be decoded from.
+const (
+	formatJSON = "json"
+	formatYAML = "yaml"
+)
+
+// parseFormats parses a comma-separated list of document formats.
+func parseFormats(list string) ([]string, error) {
+	var formats []string
+	for _, format := range strings.Split(list, ",") {
+		switch format = strings.TrimSpace(format); format {
+		case formatJSON, formatYAML:
+			formats = append(formats, format)
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown document format %q; want json or yaml", format)
+		}
+	}
+	return formats, nil
+}
+
+// decodeFormats returns the document formats the options of a struct with
+// doc are decoded from: those of the decode directive, which are json when
+// it has no value, or else the configured ones.
+func decodeFormats(doc *ast.CommentGroup, cfg *Config) ([]string, error) {
+	if hasDirective(doc, "decode") {
+		return []string{formatJSON}, nil
+	}
+	if v, ok := directiveValue(doc, "decode"); ok {
+		return parseFormats(v)
+	}
+	return cfg.Decode, nil
+}
+
+// documentKey returns the name of the tag key of field, "" when it names
+// none and "-" when it excludes the field from documents.
+func documentKey(field *ast.Field, key string) string {
+	name, _, _ := strings.Cut(structTag(field).Get(key), ",")
+	return name
+}
+
+// checkDecode names the document keys of the fields of the struct ts that
+// have none chosen by their json or yaml tag, after their option names, as
+// in "maxConns". It reports an error when two fields would share a key, or
+// a name the decoding needs is declared already.
+func checkDecode(pkg *Package, ts *ast.TypeSpec, fields []Field, formats []string) error {
+	name := ts.Name.Name
+	if _, ok := pkg.declared(toCamelCase(name) + "Document"); ok {
+		return fmt.Errorf("%s: %sDocument is declared by the package already", pkg.Fset.Position(ts.Pos()), toCamelCase(name))
+	}
+	for _, format := range formats {
+		fn := name + "OptionsFrom" + strings.ToUpper(format)
+		if _, ok := pkg.declared(fn); ok {
+			return fmt.Errorf("%s: %s is declared by the package already", pkg.Fset.Position(ts.Pos()), fn)
+		}
+	}
+
+	jsonKeys, yamlKeys := map[string]string{}, map[string]string{}
+	for i := range fields {
+		f := &fields[i]
+		if f.JSONKey == "" {
+			f.JSONKey = toCamelCase(f.OptName)
+		}
+		if f.YAMLKey == "" {
+			f.YAMLKey = toCamelCase(f.OptName)
+		}
+		for _, k := range []struct {
+			keys   map[string]string
+			key    string
+			format string
+		}{{jsonKeys, f.JSONKey, formatJSON}, {yamlKeys, f.YAMLKey, formatYAML}} {
+			if k.key == "-" {
+				continue
+			}
+			if other, ok := k.keys[k.key]; ok {
+				return fmt.Errorf("%s: %s key %s of %s is taken by %s; choose another name in the %s tag", pkg.Fset.Position(f.pos), k.format, k.key, name, other, k.format)
+			}
+			k.keys[k.key] = f.Path
+		}
+	}
+	return nil
+}
+
+// resolveDecode fills in the document types of the nested fields of the
+// structs decoded from documents, whose nested structs must be decoded from
+// the same formats.
+func resolveDecode(pkg *Package, byFile map[string][]StructData) error {
+	byName := map[string]StructData{}
+	for _, structs := range byFile {
+		for _, st := range structs {
+			byName[st.Name] = st
+		}
+	}
+	for _, structs := range byFile {
+		for i, st := range structs {
+			for j, field := range st.Fields {
+				if field.Nested == "" {
+					continue
+				}
+				child := byName[field.Nested]
+				if st.DecodeJSON && !child.DecodeJSON && field.JSONKey != "-" || st.DecodeYAML && !child.DecodeYAML && field.YAMLKey != "-" {
+					return fmt.Errorf("%s: nested struct %s is not decoded from the document formats %s is; add them to its decode directive", pkg.Fset.Position(field.pos), field.Nested, st.Name)
+				}
+				structs[i].Fields[j].NestedDocument = child.DocumentName
+			}
+		}
+	}
+	return nil
+}
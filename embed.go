@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// alloc is an embedded pointer that is allocated before a promoted field
+// behind it is set.
+type alloc struct {
+	// Path is the embedded field relative to the struct, e.g. "Base".
+	Path string
+	// Type is the type the pointer points to, e.g. "Base" or "cfg.Base".
+	Type string
+}
+
+// embedding is the chain of embedded fields through which a struct's fields
+// are promoted to the struct genopts generates options for.
+type embedding struct {
+	// path is the chain as a selector prefix, e.g. "Base.".
+	path   string
+	depth  int
+	allocs []alloc
+	// imports are the imports the allocs need.
+	imports []Import
+}
+
+// structFields returns the options of st: its tagged fields followed by the
+// tagged fields promoted from the structs it embeds. With all set, as by the
+// //genopts:generate directive, every exported field counts as tagged. Fields
+// marked //genopts:skip never do. As in Go, a field
+// shadows the fields of the same name that are embedded deeper. Fields of
+// the same name promoted from different embedded structs at the same depth
+// get the name of the embedded field as a prefix to their option name.
+func (p *Package) structFields(file *File, structName string, st *ast.StructType, all bool, scope map[string]bool, via embedding, seen map[string]bool) ([]Field, error) {
+	var fields []Field
+	direct := map[string]bool{}
+	for _, field := range st.Fields.List {
+		for _, name := range field.Names {
+			direct[name.Name] = true
+		}
+
+		if len(field.Names) == 0 || skipField(field) {
+			continue
+		}
+		wt, ok, err := lookupWithTag(field, p.Config.Tag)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p.Fset.Position(tagPos(field, p.Config.Tag)), err)
+		}
+		if !ok && all {
+			wt, ok = withTag{name: "-", flags: map[string]bool{}, params: map[string]string{}}, true
+			field = exportedNames(field)
+		}
+		if !ok || len(field.Names) == 0 {
+			continue
+		}
+		tagged, err := p.fieldData(file, structName, field, wt, scope, via)
+		if err == nil {
+			tagged, err = wt.rename(tagged)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p.Fset.Position(field.Pos()), err)
+		}
+		for i := range tagged {
+			tagged[i].JSONKey, tagged[i].YAMLKey = documentKey(field, formatJSON), documentKey(field, formatYAML)
+		}
+		fields = append(fields, tagged...)
+	}
+
+	var promoted []Field
+	for _, field := range st.Fields.List {
+		if len(field.Names) != 0 || skipField(field) {
+			continue
+		}
+		embedded, err := p.embeddedFields(file, structName, field, scope, via, seen)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p.Fset.Position(field.Pos()), err)
+		}
+		for _, f := range embedded {
+			if !direct[f.Name] {
+				promoted = append(promoted, f)
+			}
+		}
+	}
+
+	shallowest := map[string]int{}
+	count := map[string]int{}
+	for _, f := range promoted {
+		if depth, ok := shallowest[f.Name]; !ok || f.depth < depth {
+			shallowest[f.Name] = f.depth
+			count[f.Name] = 0
+		}
+		if f.depth == shallowest[f.Name] {
+			count[f.Name]++
+		}
+	}
+	for _, f := range promoted {
+		if f.depth != shallowest[f.Name] {
+			continue
+		}
+		if count[f.Name] > 1 {
+			// The name is ambiguous in Go as well; tell the options apart
+			// by the embedded field they are promoted through.
+			embeddedName, _, _ := strings.Cut(strings.TrimPrefix(f.Path, via.path), ".")
+			f.OptName = embeddedName + f.OptName
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// embeddedFields returns the tagged fields an embedded field promotes.
+func (p *Package) embeddedFields(file *File, structName string, field *ast.Field, scope map[string]bool, via embedding, seen map[string]bool) ([]Field, error) {
+	elem, depth := derefType(field.Type)
+	if depth > 1 {
+		return nil, nil
+	}
+
+	var (
+		dep      = p
+		typeName string
+	)
+	switch t := elem.(type) {
+	case *ast.Ident:
+		typeName = t.Name
+	case *ast.SelectorExpr:
+		x, ok := t.X.(*ast.Ident)
+		if !ok {
+			return nil, nil
+		}
+		var err error
+		if dep, err = p.dependency(file, x.Name); err != nil {
+			return nil, err
+		}
+		typeName = t.Sel.Name
+	default:
+		// Generic instantiations and other type expressions promote
+		// nothing genopts can set.
+		return nil, nil
+	}
+
+	ts, ok := dep.Types[typeName]
+	if !ok || ts.TypeParams != nil {
+		return nil, nil
+	}
+	st, ok := ts.Type.(*ast.StructType)
+	if !ok {
+		return nil, nil
+	}
+	key := dep.Dir + "." + typeName
+	if seen[key] {
+		return nil, nil
+	}
+	seen[key] = true
+	defer delete(seen, key)
+
+	next := embedding{
+		path:    via.path + typeName + ".",
+		depth:   via.depth + 1,
+		allocs:  via.allocs,
+		imports: via.imports,
+	}
+	if depth == 1 {
+		typ, imports, err := p.typeIn(file, elem, scope)
+		if err != nil {
+			return nil, err
+		}
+		next.allocs = append(append([]alloc(nil), via.allocs...), alloc{Path: via.path + typeName, Type: typ})
+		next.imports = append(append([]Import(nil), via.imports...), imports...)
+	}
+
+	all := hasDirective(dep.typeDocs[typeName], "generate")
+	fields, err := dep.structFields(dep.typeFiles[typeName], structName, st, all, nil, next, seen)
+	if err != nil {
+		return nil, err
+	}
+	if dep == p {
+		return fields, nil
+	}
+
+	// Only exported fields can be set from outside their package.
+	var exported []Field
+	for _, f := range fields {
+		ok := true
+		for _, name := range strings.Split(strings.TrimPrefix(f.Path, next.path), ".") {
+			ok = ok && token.IsExported(name)
+		}
+		if ok {
+			exported = append(exported, f)
+		}
+	}
+	return exported, nil
+}
+
+// skipField reports whether field is marked //genopts:skip, in its doc or
+// line comment.
+func skipField(field *ast.Field) bool {
+	return hasDirective(field.Doc, "skip") || hasDirective(field.Comment, "skip")
+}
+
+// exportedNames returns field declaring only its exported names.
+func exportedNames(field *ast.Field) *ast.Field {
+	var names []*ast.Ident
+	for _, name := range field.Names {
+		if name.IsExported() {
+			names = append(names, name)
+		}
+	}
+	f := *field
+	f.Names = names
+	return &f
+}
+
+// dependency loads the package that file imports as name, for promoting
+// the fields of its structs. Its types are rendered qualified by name.
+func (p *Package) dependency(file *File, name string) (*Package, error) {
+	imp, ok := p.Imports(file).lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown package %s", name)
+	}
+	key := imp.String()
+	if dep, ok := p.deps[key]; ok {
+		return dep, nil
+	}
+
+	bp, err := importPackage(imp.Path, p.Dir)
+	if err != nil {
+		return nil, err
+	}
+	dep, err := loadPackage(bp.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if dep == nil {
+		return nil, fmt.Errorf("package %s has no Go files", imp.Path)
+	}
+	dep.Qualifier = name
+	dep.QualifierImport = imp
+	dep.Config = p.Config
+	p.deps[key] = dep
+	return dep, nil
+}
+
+// render formats expr for the generated file, qualifying the types declared
+// in p when p is a dependency.
+func (p *Package) render(expr ast.Expr) string {
+	if p.Qualifier == "" {
+		return exprString(expr)
+	}
+	return exprString(p.qualify(expr))
+}
+
+// qualify returns a copy of the type expression expr in which the package's
+// own types are qualified with p.Qualifier.
+func (p *Package) qualify(expr ast.Expr) ast.Expr {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if _, ok := p.Types[t.Name]; ok {
+			return &ast.SelectorExpr{X: ast.NewIdent(p.Qualifier), Sel: ast.NewIdent(t.Name)}
+		}
+		return t
+	case *ast.StarExpr:
+		return &ast.StarExpr{X: p.qualify(t.X)}
+	case *ast.ParenExpr:
+		return &ast.ParenExpr{X: p.qualify(t.X)}
+	case *ast.Ellipsis:
+		return &ast.Ellipsis{Elt: p.qualify(t.Elt)}
+	case *ast.ArrayType:
+		at := &ast.ArrayType{Len: t.Len, Elt: p.qualify(t.Elt)}
+		if t.Len != nil {
+			at.Len = p.qualify(t.Len)
+		}
+		return at
+	case *ast.MapType:
+		return &ast.MapType{Key: p.qualify(t.Key), Value: p.qualify(t.Value)}
+	case *ast.ChanType:
+		return &ast.ChanType{Dir: t.Dir, Value: p.qualify(t.Value)}
+	case *ast.IndexExpr:
+		return &ast.IndexExpr{X: p.qualify(t.X), Index: p.qualify(t.Index)}
+	case *ast.IndexListExpr:
+		indices := make([]ast.Expr, len(t.Indices))
+		for i, index := range t.Indices {
+			indices[i] = p.qualify(index)
+		}
+		return &ast.IndexListExpr{X: p.qualify(t.X), Indices: indices}
+	case *ast.FuncType:
+		return &ast.FuncType{Params: p.qualifyFields(t.Params), Results: p.qualifyFields(t.Results)}
+	case *ast.StructType:
+		return &ast.StructType{Fields: p.qualifyFields(t.Fields)}
+	case *ast.InterfaceType:
+		return &ast.InterfaceType{Methods: p.qualifyFields(t.Methods)}
+	}
+	return expr
+}
+
+func (p *Package) qualifyFields(fields *ast.FieldList) *ast.FieldList {
+	if fields == nil {
+		return nil
+	}
+	out := &ast.FieldList{}
+	for _, field := range fields.List {
+		out.List = append(out.List, &ast.Field{
+			Names: field.Names,
+			Type:  p.qualify(field.Type),
+			Tag:   field.Tag,
+		})
+	}
+	return out
+}
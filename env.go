@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// envTag is the struct tag key that names the environment variable of a
+// field, as in env:"PORT". <Struct>OptionsFromEnv turns the variables that
+// are set into options.
+const envTag = "env"
+
+// envName returns the environment variable named by the env tag of field,
+// or "" when it has none.
+func envName(field *ast.Field) (string, error) {
+	name, ok := structTag(field).Lookup(envTag)
+	if !ok {
+		return "", nil
+	}
+	if name == "" || strings.ContainsAny(name, "=,\x00") {
+		return "", fmt.Errorf("invalid environment variable name %q", name)
+	}
+	return name, nil
+}
+
+// envParse returns the statements that parse the value s of the environment
+// variable name into v, of the type param written in file, and the imports
+// they need. They return the error of a value that does not parse, with the
+// variable name, as in "APP_PORT: ...".
+func (p *Package) envParse(file *File, param ast.Expr, name string, scope map[string]bool) (string, []Import, error) {
+	fail := fmt.Sprintf("return nil, fmt.Errorf(\"%%s: %%w\", prefix+%q, err)", name)
+	code, imports, err := p.parseString(file, param, fail, scope)
+	if err != nil {
+		return "", nil, err
+	}
+	if code == "" {
+		return "", nil, fmt.Errorf("env is not supported for type %s", exprString(param))
+	}
+	if strings.Contains(code, fail) {
+		imports = append(imports, Import{Path: "fmt"})
+	}
+	return code, imports, nil
+}
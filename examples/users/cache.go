@@ -0,0 +1,8 @@
+package myapp
+
+import "time"
+
+type Cache[K comparable, V any] struct {
+	TTL   time.Duration `with:"-,default=5m"`
+	Items map[K]V       `with:"-,append"`
+}
@@ -0,0 +1,12 @@
+package myapp
+
+// DBConfig is nested in Server, whose WithDB option takes DBConfig options.
+// It can be built with NewDBConfigBuilder().Host("db").Build() too, and its
+// options read from the environment with DBConfigOptionsFromEnv.
+//
+//genopts:builder
+//genopts:decode=json,yaml
+type DBConfig struct {
+	Host string `with:"-,required" env:"DB_HOST"`
+	Port int    `with:"-,default=5432,min=1,max=65535" env:"DB_PORT"`
+}
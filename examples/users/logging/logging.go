@@ -0,0 +1,11 @@
+package logging
+
+// Config configures the logger of a service. Services embed it to get its
+// options alongside their own. Being a value, it has copy-on-write methods
+// too, as in cfg.WithLevel("debug").
+//
+//genopts:immutable
+type Config struct {
+	Level  string `with:"-,default=info,oneof=debug|info|warn|error"`
+	Format string `with:"-,default=text,oneof=text|json"`
+}
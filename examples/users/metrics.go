@@ -0,0 +1,13 @@
+package myapp
+
+import "time"
+
+// Metrics gets options for all its exported fields, whose tags belong to
+// encoding/json.
+//
+//genopts:generate
+type Metrics struct {
+	Namespace string        `json:"namespace"`
+	Interval  time.Duration `json:"interval" with:"-,default=15s,min=1s"`
+	Registry  any           `json:"-"` //genopts:skip
+}
@@ -0,0 +1,38 @@
+package myapp
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Server reports every misconfigured option at once. Its options can be
+// read from config files with ServerOptionsFromYAML, as in
+//
+//	addr: ":9090"
+//	db:
+//	  host: db.internal
+//
+//genopts:aggregate
+//genopts:decode=json,yaml
+type Server struct {
+	Addr     string            `with:"-" default:":8080"`
+	Timeout  time.Duration     `with:"-,default=30s,min=1s"`
+	Tags     []string          `with:"-,append" default:"api,internal"`
+	Headers  map[string]string `with:"-,append"`
+	Env      string            `with:"-,required,oneof=dev|prod"`
+	MaxConns *int              `with:"-,min=1"`
+	DB       *DBConfig         `with:"-,nested"`
+
+	// set records the options applied, so that s.IsSet("Timeout") tells
+	// an explicit timeout from the default one.
+	set serverFieldSet
+}
+
+// Validate reports whether the server can be started with its settings.
+func (s Server) Validate() error {
+	if s.Env == "prod" && !strings.Contains(s.Addr, ":") {
+		return errors.New("prod servers need an explicit port")
+	}
+	return nil
+}
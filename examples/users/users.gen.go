@@ -12,27 +12,56 @@ func (f userOptionFunc) apply(s *User) error {
 	return f(s)
 }
 
+// userFieldOption implements UserOption for the options that set a
+// named field.
+type userFieldOption struct {
+	field string
+	fn    userOptionFunc
+}
+
+func (o userFieldOption) apply(s *User) error {
+	return o.fn(s)
+}
+
 func WithName(v string) UserOption {
-	return userOptionFunc(func(s *User) error {
+	return userFieldOption{field: "Name", fn: func(s *User) error {
 		s.Name = v
 		return nil
-	})
+	}}
 }
 
 func WithAge(v int) UserOption {
-	return userOptionFunc(func(s *User) error {
+	return userFieldOption{field: "Age", fn: func(s *User) error {
 		s.Age = v
 		return nil
-	})
+	}}
 }
 
-func NewUser(opts ...UserOption) (*User, error) {
-	obj := &User{}
+// applyUserOptions applies opts to obj in order and stops at the first
+// error. It is shared by the generated and hand-written constructors.
+func applyUserOptions(obj *User, opts ...UserOption) error {
 	for _, opt := range opts {
 		if err := opt.apply(obj); err != nil {
-			return nil, err
+			return err
 		}
 	}
+	return nil
+}
+
+// Apply reconfigures s with opts. s may be partially updated when an option
+// fails.
+func (s *User) Apply(opts ...UserOption) error {
+	if err := applyUserOptions(s, opts...); err != nil {
+		return err
+	}
+	return nil
+}
+
+func NewUser(opts ...UserOption) (*User, error) {
+	obj := &User{}
+	if err := applyUserOptions(obj, opts...); err != nil {
+		return nil, err
+	}
 	return obj, nil
 }
 
@@ -46,27 +75,56 @@ func (f secretUserOptionFunc) apply(s *SecretUser) error {
 	return f(s)
 }
 
+// secretUserFieldOption implements SecretUserOption for the options that set a
+// named field.
+type secretUserFieldOption struct {
+	field string
+	fn    secretUserOptionFunc
+}
+
+func (o secretUserFieldOption) apply(s *SecretUser) error {
+	return o.fn(s)
+}
+
 func SecretUser_WithName(v string) SecretUserOption {
-	return secretUserOptionFunc(func(s *SecretUser) error {
+	return secretUserFieldOption{field: "Name", fn: func(s *SecretUser) error {
 		s.Name = v
 		return nil
-	})
+	}}
 }
 
 func SecretUser_WithAge(v int) SecretUserOption {
-	return secretUserOptionFunc(func(s *SecretUser) error {
+	return secretUserFieldOption{field: "Age", fn: func(s *SecretUser) error {
 		s.Age = v
 		return nil
-	})
+	}}
 }
 
-func NewSecretUser(opts ...SecretUserOption) (*SecretUser, error) {
-	obj := &SecretUser{}
+// applySecretUserOptions applies opts to obj in order and stops at the first
+// error. It is shared by the generated and hand-written constructors.
+func applySecretUserOptions(obj *SecretUser, opts ...SecretUserOption) error {
 	for _, opt := range opts {
 		if err := opt.apply(obj); err != nil {
-			return nil, err
+			return err
 		}
 	}
+	return nil
+}
+
+// Apply reconfigures s with opts. s may be partially updated when an option
+// fails.
+func (s *SecretUser) Apply(opts ...SecretUserOption) error {
+	if err := applySecretUserOptions(s, opts...); err != nil {
+		return err
+	}
+	return nil
+}
+
+func NewSecretUser(opts ...SecretUserOption) (*SecretUser, error) {
+	obj := &SecretUser{}
+	if err := applySecretUserOptions(obj, opts...); err != nil {
+		return nil, err
+	}
 	return obj, nil
 }
 
@@ -80,19 +138,48 @@ func (f timeOptionFunc) apply(s *Time) error {
 	return f(s)
 }
 
+// timeFieldOption implements TimeOption for the options that set a
+// named field.
+type timeFieldOption struct {
+	field string
+	fn    timeOptionFunc
+}
+
+func (o timeFieldOption) apply(s *Time) error {
+	return o.fn(s)
+}
+
 func WithNano(v int64) TimeOption {
-	return timeOptionFunc(func(s *Time) error {
+	return timeFieldOption{field: "Nano", fn: func(s *Time) error {
 		s.Nano = v
 		return nil
-	})
+	}}
 }
 
-func NewTime(opts ...TimeOption) (*Time, error) {
-	obj := &Time{}
+// applyTimeOptions applies opts to obj in order and stops at the first
+// error. It is shared by the generated and hand-written constructors.
+func applyTimeOptions(obj *Time, opts ...TimeOption) error {
 	for _, opt := range opts {
 		if err := opt.apply(obj); err != nil {
-			return nil, err
+			return err
 		}
 	}
+	return nil
+}
+
+// Apply reconfigures s with opts. s may be partially updated when an option
+// fails.
+func (s *Time) Apply(opts ...TimeOption) error {
+	if err := applyTimeOptions(s, opts...); err != nil {
+		return err
+	}
+	return nil
+}
+
+func NewTime(opts ...TimeOption) (*Time, error) {
+	obj := &Time{}
+	if err := applyTimeOptions(obj, opts...); err != nil {
+		return nil, err
+	}
 	return obj, nil
 }
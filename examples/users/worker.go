@@ -0,0 +1,15 @@
+package myapp
+
+import "genopts/examples/users/logging"
+
+// Worker gets WithLevel and WithFormat from the embedded logging.Config, and
+// ForQueue and WithWorkers, named by their tags. RegisterWorkerFlags binds
+// them to the -level, -format, -queue and -workers flags.
+//
+//genopts:flags
+type Worker struct {
+	logging.Config
+	// Queue is the name of the queue to consume.
+	Queue       string `with:"-,required,name=ForQueue"`
+	Concurrency int    `with:"Workers,default=4,min=1" flag:",number of concurrent jobs"`
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// flagTag is the struct tag key that names the command line flag of a
+// field and describes it, as in flag:"max-conns,maximum number of
+// connections". Register<Struct>Flags registers the flags on a FlagSet.
+const flagTag = "flag"
+
+// flagSpec is a parsed flag tag. A name of "-" gives the field no flag, and
+// an empty one lets the name derive from the option name. An empty usage
+// is taken from the doc comment of the field.
+type flagSpec struct {
+	name, usage string
+	tagged      bool
+}
+
+// lookupFlag returns the flag tag of field, or the defaults when it has
+// none.
+func lookupFlag(field *ast.Field) (flagSpec, error) {
+	tag, ok := structTag(field).Lookup(flagTag)
+	if !ok {
+		return flagSpec{usage: fieldUsage(field)}, nil
+	}
+	name, usage, _ := strings.Cut(tag, ",")
+	if strings.ContainsAny(name, "= \t") || strings.HasPrefix(name, "-") && name != "-" {
+		return flagSpec{}, fmt.Errorf("invalid flag name %q", name)
+	}
+	if usage == "" {
+		usage = fieldUsage(field)
+	}
+	return flagSpec{name: name, usage: usage, tagged: true}, nil
+}
+
+// fieldUsage returns the doc comment of field, or else its line comment,
+// as a single line.
+func fieldUsage(field *ast.Field) string {
+	doc := field.Doc
+	if doc == nil {
+		doc = field.Comment
+	}
+	if doc == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(doc.Text()), " ")
+}
+
+// flagName derives the name of the flag of an option from its name, as in
+// "max-conns" for MaxConns.
+func flagName(optName string) string {
+	words := splitWords(optName)
+	for i, word := range words {
+		words[i] = strings.ToLower(word)
+	}
+	return strings.Join(words, "-")
+}
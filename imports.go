@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Import is an import spec of a generated file.
+type Import struct {
+	// Name is the explicit package name of the spec, "" when the import is
+	// not renamed and "." for a dot import.
+	Name string
+	Path string
+}
+
+func (i Import) String() string {
+	if i.Name == "" {
+		return strconv.Quote(i.Path)
+	}
+	return i.Name + " " + strconv.Quote(i.Path)
+}
+
+// fileImports resolves the package qualifiers used in a source file to the
+// import specs that declare them.
+type fileImports struct {
+	dir    string
+	specs  []Import
+	byName map[string]Import
+}
+
+func newFileImports(dir string, file *ast.File) *fileImports {
+	fi := &fileImports{dir: dir, byName: map[string]Import{}}
+	for _, spec := range file.Imports {
+		imp := Import{Path: strings.Trim(spec.Path.Value, `"`)}
+		if spec.Name != nil {
+			imp.Name = spec.Name.Name
+		}
+		switch imp.Name {
+		case "_":
+			continue
+		case "":
+			// Most packages are named after the last element of their
+			// path, so try that before asking the build system.
+			fi.byName[guessPackageName(imp.Path)] = imp
+		default:
+			fi.byName[imp.Name] = imp
+		}
+		fi.specs = append(fi.specs, imp)
+	}
+	return fi
+}
+
+// uses returns the imports referenced by expr. Unqualified identifiers that
+// are neither predeclared, declared in pkg nor type parameters in scope are
+// looked up in the file's dot imports. Its errors leave the position of expr
+// to the caller.
+func (fi *fileImports) uses(pkg *Package, expr ast.Expr, scope map[string]bool) ([]Import, error) {
+	var (
+		imports []Import
+		err     error
+	)
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if err != nil {
+			return false
+		}
+		switch n := n.(type) {
+		case *ast.Field:
+			// Only the types of struct fields and func parameters matter,
+			// not their names.
+			var fieldImports []Import
+			fieldImports, err = fi.uses(pkg, n.Type, scope)
+			imports = append(imports, fieldImports...)
+			return false
+		case *ast.ArrayType:
+			// Array lengths are constants, which only need an import when
+			// they are qualified.
+			exprs := []ast.Expr{n.Elt}
+			if sel, ok := n.Len.(*ast.SelectorExpr); ok {
+				exprs = append(exprs, sel)
+			}
+			for _, e := range exprs {
+				var elemImports []Import
+				if elemImports, err = fi.uses(pkg, e, scope); err != nil {
+					break
+				}
+				imports = append(imports, elemImports...)
+			}
+			return false
+		case *ast.SelectorExpr:
+			x, ok := n.X.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			imp, ok := fi.lookup(x.Name)
+			if !ok {
+				err = fmt.Errorf("unknown package %s", x.Name)
+				return false
+			}
+			imports = append(imports, imp)
+			return false
+		case *ast.Ident:
+			if _, ok := pkg.Types[n.Name]; ok {
+				if pkg.Qualifier != "" {
+					imports = append(imports, pkg.QualifierImport)
+				}
+				return true
+			}
+			if scope[n.Name] || types.Universe.Lookup(n.Name) != nil {
+				return true
+			}
+			imp, ok := fi.lookupDot(n.Name)
+			if !ok {
+				err = fmt.Errorf("undeclared type %s", n.Name)
+				return false
+			}
+			imports = append(imports, imp)
+		}
+		return true
+	})
+	return imports, err
+}
+
+func (fi *fileImports) lookup(name string) (Import, bool) {
+	if imp, ok := fi.byName[name]; ok {
+		return imp, true
+	}
+
+	// The package name did not match its path, e.g. github.com/foo/go-bar
+	// declaring package bar. Resolve the real names of the unnamed imports.
+	for _, imp := range fi.specs {
+		if imp.Name != "" {
+			continue
+		}
+		bp, err := importPackage(imp.Path, fi.dir)
+		if err != nil || bp.Name != name {
+			continue
+		}
+		fi.byName[name] = imp
+		return imp, true
+	}
+	return Import{}, false
+}
+
+func (fi *fileImports) lookupDot(name string) (Import, bool) {
+	for _, imp := range fi.specs {
+		if imp.Name == "." && packageDeclares(imp.Path, fi.dir, name) {
+			return imp, true
+		}
+	}
+	return Import{}, false
+}
+
+// importPackage locates the package at importPath as imported from srcDir.
+// The go command has to run inside srcDir to resolve module imports.
+func importPackage(importPath, srcDir string) (*build.Package, error) {
+	ctxt := build.Default
+	ctxt.Dir = srcDir
+	return ctxt.Import(importPath, srcDir, 0)
+}
+
+// packageDeclares reports whether the package at importPath declares the
+// top-level identifier name.
+func packageDeclares(importPath, srcDir, name string) bool {
+	bp, err := importPackage(importPath, srcDir)
+	if err != nil {
+		return false
+	}
+	fset := token.NewFileSet()
+	for _, filename := range bp.GoFiles {
+		node, err := parser.ParseFile(fset, path.Join(bp.Dir, filename), nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		for _, decl := range node.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok {
+				continue
+			}
+			for _, spec := range genDecl.Specs {
+				if ts, ok := spec.(*ast.TypeSpec); ok && ts.Name.Name == name {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// guessPackageName returns the conventional name of the package at
+// importPath: its last element without a major version suffix.
+func guessPackageName(importPath string) string {
+	name := path.Base(importPath)
+	if len(name) > 1 && name[0] == 'v' && strings.Trim(name[1:], "0123456789") == "" {
+		name = path.Base(path.Dir(importPath))
+	}
+	if i := strings.Index(name, ".v"); i > 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// mergeImports dedupes imports and sorts them by path. Two different
+// packages referenced by the same name cannot share a generated file.
+func mergeImports(imports []Import) ([]Import, error) {
+	seen := map[Import]bool{}
+	byName := map[string]string{}
+	var out []Import
+	for _, imp := range imports {
+		if seen[imp] {
+			continue
+		}
+		seen[imp] = true
+
+		if imp.Name != "." {
+			name := imp.Name
+			if name == "" {
+				name = guessPackageName(imp.Path)
+			}
+			if other, ok := byName[name]; ok && other != imp.Path {
+				return nil, fmt.Errorf("packages %q and %q are both imported as %s", other, imp.Path, name)
+			}
+			byName[name] = imp.Path
+		}
+		out = append(out, imp)
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Path != out[j].Path {
+			return out[i].Path < out[j].Path
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out, nil
+}
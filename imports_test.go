@@ -0,0 +1,212 @@
+package main
+
+import (
+	"go/parser"
+	"reflect"
+	"testing"
+)
+
+func TestGuessPackageName(t *testing.T) {
+	tests := []struct {
+		name       string
+		importPath string
+		want       string
+	}{
+		{name: "should pass; standard package", importPath: "fmt", want: "fmt"},
+		{name: "should pass; last element", importPath: "net/http", want: "http"},
+		{name: "should pass; major version suffix", importPath: "github.com/jackc/pgx/v5", want: "pgx"},
+		{name: "should pass; multi-digit major version", importPath: "example.com/lib/v10", want: "lib"},
+		{name: "should pass; gopkg.in version", importPath: "gopkg.in/yaml.v3", want: "yaml"},
+		{name: "should pass; element starting with v", importPath: "example.com/version", want: "version"},
+		{name: "should pass; lone v", importPath: "example.com/v", want: "v"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := guessPackageName(tt.importPath); got != tt.want {
+				t.Errorf("guessPackageName(%q) = %q, want %q", tt.importPath, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeImports(t *testing.T) {
+	tests := []struct {
+		name    string
+		imports []Import
+		want    []Import
+		wantErr bool
+	}{
+		{
+			name: "should pass; empty",
+		},
+		{
+			name:    "should pass; deduped and sorted by path",
+			imports: []Import{{Path: "time"}, {Path: "fmt"}, {Path: "time"}, {Path: "errors"}},
+			want:    []Import{{Path: "errors"}, {Path: "fmt"}, {Path: "time"}},
+		},
+		{
+			name:    "should pass; same path under two names",
+			imports: []Import{{Name: "tx", Path: "text/template"}, {Path: "text/template"}},
+			want:    []Import{{Path: "text/template"}, {Name: "tx", Path: "text/template"}},
+		},
+		{
+			name:    "should pass; renamed import avoids a clash",
+			imports: []Import{{Path: "math/rand"}, {Name: "crand", Path: "crypto/rand"}},
+			want:    []Import{{Name: "crand", Path: "crypto/rand"}, {Path: "math/rand"}},
+		},
+		{
+			name:    "should pass; dot imports have no name",
+			imports: []Import{{Name: ".", Path: "net/url"}, {Name: ".", Path: "time"}},
+			want:    []Import{{Name: ".", Path: "net/url"}, {Name: ".", Path: "time"}},
+		},
+		{
+			name:    "should pass; version suffix names the package",
+			imports: []Import{{Path: "gopkg.in/yaml.v3"}, {Path: "gopkg.in/yaml.v3"}},
+			want:    []Import{{Path: "gopkg.in/yaml.v3"}},
+		},
+		{
+			name:    "should fail; two packages of the same name",
+			imports: []Import{{Path: "math/rand"}, {Path: "crypto/rand"}},
+			wantErr: true,
+		},
+		{
+			name:    "should fail; renamed to the name of another package",
+			imports: []Import{{Path: "fmt"}, {Name: "fmt", Path: "example.com/fmt"}},
+			wantErr: true,
+		},
+		{
+			name:    "should fail; two major versions",
+			imports: []Import{{Path: "example.com/lib"}, {Path: "example.com/lib/v2"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergeImports(tt.imports)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("mergeImports() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeImports() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+const importsSrc = `package p
+
+import (
+	_ "embed"
+	"math"
+	. "net/url"
+	tx "text/template"
+	"time"
+)
+
+type Local struct{}
+
+type Pair[K comparable, V any] struct{}
+`
+
+func TestFileImportsUses(t *testing.T) {
+	tests := []struct {
+		name      string
+		expr      string
+		scope     map[string]bool
+		qualified bool
+		want      []Import
+		wantErr   bool
+	}{
+		{
+			name: "should pass; predeclared",
+			expr: "map[string][]int",
+		},
+		{
+			name: "should pass; declared by the package",
+			expr: "*Local",
+		},
+		{
+			name:      "should pass; declared by the qualified package",
+			expr:      "[]Local",
+			qualified: true,
+			want:      []Import{{Path: "example.com/p"}},
+		},
+		{
+			name: "should pass; qualified",
+			expr: "map[string]time.Duration",
+			want: []Import{{Path: "time"}},
+		},
+		{
+			name: "should pass; alias",
+			expr: "*tx.Template",
+			want: []Import{{Name: "tx", Path: "text/template"}},
+		},
+		{
+			name: "should pass; dot import",
+			expr: "*URL",
+			want: []Import{{Name: ".", Path: "net/url"}},
+		},
+		{
+			name: "should pass; qualified array length",
+			expr: "[math.MaxInt8]time.Duration",
+			want: []Import{{Path: "time"}, {Path: "math"}},
+		},
+		{
+			name: "should pass; unqualified array length",
+			expr: "[size]byte",
+		},
+		{
+			name:  "should pass; type params in scope",
+			expr:  "Pair[K, []V]",
+			scope: map[string]bool{"K": true, "V": true},
+		},
+		{
+			name: "should pass; names of params and fields",
+			expr: "func(Duration time.Duration) struct{ URL *URL }",
+			want: []Import{{Path: "time"}, {Name: ".", Path: "net/url"}},
+		},
+		{
+			name:    "should fail; type param out of scope",
+			expr:    "Pair[K, V]",
+			scope:   map[string]bool{"K": true},
+			wantErr: true,
+		},
+		{
+			name:    "should fail; blank import",
+			expr:    "embed.FS",
+			wantErr: true,
+		},
+		{
+			name:    "should fail; unknown package",
+			expr:    "strings.Builder",
+			wantErr: true,
+		},
+		{
+			name:    "should fail; undeclared type",
+			expr:    "Missing",
+			wantErr: true,
+		},
+	}
+	pkg := loadTestPackage(t, importsSrc)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := parser.ParseExpr(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := pkg
+			if tt.qualified {
+				q := *pkg
+				q.Qualifier, q.QualifierImport = "p", Import{Path: "example.com/p"}
+				p = &q
+			}
+			got, err := p.Imports(p.Files[0]).uses(p, expr, tt.scope)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("uses() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("uses() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
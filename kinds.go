@@ -0,0 +1,318 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scalarKind classifies the types genopts can write literals for.
+type scalarKind int
+
+const (
+	kindString scalarKind = iota + 1
+	kindBool
+	kindInt
+	kindUint
+	kindFloat
+	kindDuration
+)
+
+// scalar is a resolved scalar type.
+type scalar struct {
+	Kind scalarKind
+	// Bits is the size of numeric kinds.
+	Bits int
+	// TimePkg is the name the time package is imported as when the type is
+	// spelled time.Duration rather than named after it.
+	TimePkg string
+}
+
+var basicScalars = map[string]scalar{
+	"string":  {Kind: kindString},
+	"bool":    {Kind: kindBool},
+	"int":     {Kind: kindInt, Bits: 64},
+	"int8":    {Kind: kindInt, Bits: 8},
+	"int16":   {Kind: kindInt, Bits: 16},
+	"int32":   {Kind: kindInt, Bits: 32},
+	"rune":    {Kind: kindInt, Bits: 32},
+	"int64":   {Kind: kindInt, Bits: 64},
+	"uint":    {Kind: kindUint, Bits: 64},
+	"uint8":   {Kind: kindUint, Bits: 8},
+	"byte":    {Kind: kindUint, Bits: 8},
+	"uint16":  {Kind: kindUint, Bits: 16},
+	"uint32":  {Kind: kindUint, Bits: 32},
+	"uint64":  {Kind: kindUint, Bits: 64},
+	"uintptr": {Kind: kindUint, Bits: 64},
+	"float32": {Kind: kindFloat, Bits: 32},
+	"float64": {Kind: kindFloat, Bits: 64},
+}
+
+// maxTypeDepth bounds how many named types are followed to find an
+// underlying type.
+const maxTypeDepth = 16
+
+// underlying follows the named types declared in the package until it
+// reaches a type literal, a predeclared type or an imported type. It returns
+// that type together with the file it appears in.
+func (p *Package) underlying(file *File, expr ast.Expr) (*File, ast.Expr) {
+	for range maxTypeDepth {
+		ident, ok := expr.(*ast.Ident)
+		if !ok {
+			break
+		}
+		ts, ok := p.Types[ident.Name]
+		if !ok {
+			break
+		}
+		file, expr = p.typeFiles[ident.Name], ts.Type
+	}
+	return file, expr
+}
+
+// resolveScalar reports whether expr, as written in file, is a scalar type
+// and which one.
+func (p *Package) resolveScalar(file *File, expr ast.Expr) (scalar, bool) {
+	origin := expr
+	file, expr = p.underlying(file, expr)
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if s, ok := basicScalars[t.Name]; ok {
+			return s, true
+		}
+		// Duration of a dot import of the time package. Literals are
+		// written in nanoseconds then, as the time package has no name.
+		if imp, ok := p.Imports(file).lookupDot(t.Name); ok && imp.Path == "time" && t.Name == "Duration" {
+			return scalar{Kind: kindDuration, Bits: 64}, true
+		}
+	case *ast.SelectorExpr:
+		x, ok := t.X.(*ast.Ident)
+		if !ok || t.Sel.Name != "Duration" {
+			return scalar{}, false
+		}
+		if imp, ok := p.Imports(file).lookup(x.Name); ok && imp.Path == "time" {
+			s := scalar{Kind: kindDuration, Bits: 64}
+			if expr == origin {
+				s.TimePkg = x.Name
+			}
+			return s, true
+		}
+	}
+	return scalar{}, false
+}
+
+// sliceElem returns the element type of expr if it is a slice type.
+func (p *Package) sliceElem(file *File, expr ast.Expr) (*File, ast.Expr, bool) {
+	file, expr = p.underlying(file, expr)
+	if at, ok := expr.(*ast.ArrayType); ok && at.Len == nil {
+		return file, at.Elt, true
+	}
+	return nil, nil, false
+}
+
+// derefType strips the pointers off expr and returns the pointed-to type and
+// the number of pointers stripped.
+func derefType(expr ast.Expr) (ast.Expr, int) {
+	n := 0
+	for {
+		switch t := expr.(type) {
+		case *ast.StarExpr:
+			expr = t.X
+			n++
+		case *ast.ParenExpr:
+			expr = t.X
+		default:
+			return expr, n
+		}
+	}
+}
+
+// isValueType reports whether pointers to expr are better set from a value:
+// scalars and the package's own non-struct types.
+func (p *Package) isValueType(file *File, expr ast.Expr) bool {
+	if _, ok := p.resolveScalar(file, expr); ok {
+		return true
+	}
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if _, ok := p.Types[t.Name]; !ok && types.Universe.Lookup(t.Name) == nil {
+			// A type of a dot import.
+			return false
+		}
+		_, typ := p.underlying(file, t)
+		_, isStruct := typ.(*ast.StructType)
+		return !isStruct
+	case *ast.ArrayType, *ast.MapType:
+		return true
+	}
+	return false
+}
+
+// pointerAssign returns the statements that store the value v in target
+// through depth pointers.
+func pointerAssign(target string, depth int) string {
+	if depth == 0 {
+		return target + " = v"
+	}
+	var b strings.Builder
+	prev := "v"
+	for i := 1; i < depth; i++ {
+		name := fmt.Sprintf("p%d", i)
+		fmt.Fprintf(&b, "%s := &%s\n", name, prev)
+		prev = name
+	}
+	fmt.Fprintf(&b, "%s = &%s", target, prev)
+	return b.String()
+}
+
+// typeIn renders the type expr, written in file, for a generated file and
+// returns the imports it needs there. scope holds the type parameters expr
+// may refer to.
+func (p *Package) typeIn(file *File, expr ast.Expr, scope map[string]bool) (string, []Import, error) {
+	imports, err := p.Imports(file).uses(p, expr, scope)
+	if err != nil {
+		return "", nil, err
+	}
+	return p.render(expr), imports, nil
+}
+
+// defaultExpr renders the default value of a field of type expr, declared
+// in file, as a Go expression.
+func (p *Package) defaultExpr(file *File, expr ast.Expr, value, sep string) (string, error) {
+	if s, ok := p.resolveScalar(file, expr); ok {
+		return s.literal(value)
+	}
+
+	elemFile, elem, ok := p.sliceElem(file, expr)
+	if !ok {
+		return "", fmt.Errorf("defaults are not supported for type %s", exprString(expr))
+	}
+	s, ok := p.resolveScalar(elemFile, elem)
+	if !ok {
+		return "", fmt.Errorf("defaults are not supported for type %s", exprString(expr))
+	}
+	if _, ok := expr.(*ast.ArrayType); !ok {
+		// The time package is only known to be imported by the generated
+		// file when the field spells out []time.Duration.
+		s.TimePkg = ""
+	}
+
+	var elems []string
+	for _, v := range defaultElems(value, sep) {
+		lit, err := s.literal(v)
+		if err != nil {
+			return "", err
+		}
+		elems = append(elems, lit)
+	}
+	return p.render(expr) + "{" + strings.Join(elems, ", ") + "}", nil
+}
+
+// defaultElems splits the default value of a slice field, optionally
+// enclosed in brackets, into its elements.
+func defaultElems(value, sep string) []string {
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	if value == "" {
+		return nil
+	}
+	elems := strings.Split(value, sep)
+	for i, v := range elems {
+		elems[i] = strings.TrimSpace(v)
+	}
+	return elems
+}
+
+// literal renders value, written as text, as an untyped constant of kind s.
+func (s scalar) literal(value string) (string, error) {
+	switch s.Kind {
+	case kindString:
+		return strconv.Quote(value), nil
+	case kindBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid bool %q", value)
+		}
+		return strconv.FormatBool(b), nil
+	case kindInt:
+		i, err := strconv.ParseInt(value, 0, s.Bits)
+		if err != nil {
+			return "", fmt.Errorf("invalid int%d %q", s.Bits, value)
+		}
+		return strconv.FormatInt(i, 10), nil
+	case kindUint:
+		u, err := strconv.ParseUint(value, 0, s.Bits)
+		if err != nil {
+			return "", fmt.Errorf("invalid uint%d %q", s.Bits, value)
+		}
+		return strconv.FormatUint(u, 10), nil
+	case kindFloat:
+		f, err := strconv.ParseFloat(value, s.Bits)
+		if err != nil {
+			return "", fmt.Errorf("invalid float%d %q", s.Bits, value)
+		}
+		return strconv.FormatFloat(f, 'g', -1, s.Bits), nil
+	case kindDuration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid duration %q", value)
+		}
+		return durationLiteral(d, s.TimePkg), nil
+	}
+	return "", fmt.Errorf("unsupported kind %d", s.Kind)
+}
+
+// compare compares the values a and b of kind s, written as text, and
+// returns -1, 0 or +1 as cmp.Compare does.
+func (s scalar) compare(a, b string) (int, error) {
+	switch s.Kind {
+	case kindString:
+		return strings.Compare(a, b), nil
+	case kindInt:
+		x, errA := strconv.ParseInt(a, 0, s.Bits)
+		y, errB := strconv.ParseInt(b, 0, s.Bits)
+		return cmp.Compare(x, y), errors.Join(errA, errB)
+	case kindUint:
+		x, errA := strconv.ParseUint(a, 0, s.Bits)
+		y, errB := strconv.ParseUint(b, 0, s.Bits)
+		return cmp.Compare(x, y), errors.Join(errA, errB)
+	case kindFloat:
+		x, errA := strconv.ParseFloat(a, s.Bits)
+		y, errB := strconv.ParseFloat(b, s.Bits)
+		return cmp.Compare(x, y), errors.Join(errA, errB)
+	case kindDuration:
+		x, errA := time.ParseDuration(a)
+		y, errB := time.ParseDuration(b)
+		return cmp.Compare(x, y), errors.Join(errA, errB)
+	}
+	return 0, fmt.Errorf("unordered kind %d", s.Kind)
+}
+
+// durationLiteral renders d in the largest unit of the time package that
+// divides it, or in nanoseconds when the time package is not imported.
+func durationLiteral(d time.Duration, timePkg string) string {
+	if timePkg == "" || d == 0 {
+		return strconv.FormatInt(int64(d), 10)
+	}
+	units := []struct {
+		name string
+		d    time.Duration
+	}{
+		{"Hour", time.Hour},
+		{"Minute", time.Minute},
+		{"Second", time.Second},
+		{"Millisecond", time.Millisecond},
+		{"Microsecond", time.Microsecond},
+		{"Nanosecond", time.Nanosecond},
+	}
+	for _, unit := range units {
+		if d%unit.d == 0 {
+			return strconv.FormatInt(int64(d/unit.d), 10) + " * " + timePkg + "." + unit.name
+		}
+	}
+	return strconv.FormatInt(int64(d), 10)
+}
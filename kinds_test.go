@@ -0,0 +1,184 @@
+package main
+
+import (
+	"go/parser"
+	"testing"
+	"time"
+)
+
+func TestScalarLiteral(t *testing.T) {
+	tests := []struct {
+		name    string
+		scalar  scalar
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "should pass; string", scalar: basicScalars["string"], value: `say "hi"`, want: `"say \"hi\""`},
+		{name: "should pass; bool", scalar: basicScalars["bool"], value: "1", want: "true"},
+		{name: "should fail; bool", scalar: basicScalars["bool"], value: "yes", wantErr: true},
+		{name: "should pass; decimal int", scalar: basicScalars["int"], value: "-42", want: "-42"},
+		{name: "should pass; hex int", scalar: basicScalars["int"], value: "0x1F", want: "31"},
+		{name: "should pass; octal int", scalar: basicScalars["int"], value: "0o17", want: "15"},
+		{name: "should pass; binary int", scalar: basicScalars["int"], value: "0b101", want: "5"},
+		{name: "should pass; int with underscores", scalar: basicScalars["int"], value: "1_000", want: "1000"},
+		{name: "should pass; int8 bounds", scalar: basicScalars["int8"], value: "-128", want: "-128"},
+		{name: "should fail; int8 out of range", scalar: basicScalars["int8"], value: "128", wantErr: true},
+		{name: "should fail; int of a float", scalar: basicScalars["int"], value: "1.5", wantErr: true},
+		{name: "should pass; hex uint8", scalar: basicScalars["uint8"], value: "0xff", want: "255"},
+		{name: "should fail; uint8 out of range", scalar: basicScalars["uint8"], value: "256", wantErr: true},
+		{name: "should fail; negative uint", scalar: basicScalars["uint"], value: "-1", wantErr: true},
+		{name: "should pass; float trailing zeros", scalar: basicScalars["float64"], value: "1.50", want: "1.5"},
+		{name: "should pass; float exponent", scalar: basicScalars["float64"], value: "1e3", want: "1000"},
+		{name: "should pass; large float", scalar: basicScalars["float64"], value: "1e21", want: "1e+21"},
+		{name: "should pass; float32 precision", scalar: basicScalars["float32"], value: "0.1", want: "0.1"},
+		{name: "should fail; float32 out of range", scalar: basicScalars["float32"], value: "1e39", wantErr: true},
+		{name: "should fail; float", scalar: basicScalars["float64"], value: "one", wantErr: true},
+		{name: "should pass; duration in minutes", scalar: scalar{Kind: kindDuration, Bits: 64, TimePkg: "time"}, value: "1h30m", want: "90 * time.Minute"},
+		{name: "should pass; negative duration", scalar: scalar{Kind: kindDuration, Bits: 64, TimePkg: "time"}, value: "-5s", want: "-5 * time.Second"},
+		{name: "should pass; duration in nanoseconds", scalar: scalar{Kind: kindDuration, Bits: 64}, value: "5s", want: "5000000000"},
+		{name: "should fail; duration without unit", scalar: scalar{Kind: kindDuration, Bits: 64, TimePkg: "time"}, value: "5", wantErr: true},
+		{name: "should fail; unknown kind", scalar: scalar{}, value: "1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.scalar.literal(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("literal(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("literal(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDurationLiteral(t *testing.T) {
+	tests := []struct {
+		name    string
+		d       time.Duration
+		timePkg string
+		want    string
+	}{
+		{name: "should pass; hours", d: 2 * time.Hour, timePkg: "time", want: "2 * time.Hour"},
+		{name: "should pass; minutes", d: 90 * time.Minute, timePkg: "time", want: "90 * time.Minute"},
+		{name: "should pass; seconds", d: 61 * time.Second, timePkg: "time", want: "61 * time.Second"},
+		{name: "should pass; milliseconds", d: 1500 * time.Millisecond, timePkg: "time", want: "1500 * time.Millisecond"},
+		{name: "should pass; microseconds", d: 3 * time.Microsecond, timePkg: "time", want: "3 * time.Microsecond"},
+		{name: "should pass; nanoseconds", d: 1500 * time.Nanosecond, timePkg: "time", want: "1500 * time.Nanosecond"},
+		{name: "should pass; renamed time package", d: time.Second, timePkg: "stdtime", want: "1 * stdtime.Second"},
+		{name: "should pass; zero", d: 0, timePkg: "time", want: "0"},
+		{name: "should pass; time package not imported", d: time.Millisecond, want: "1000000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := durationLiteral(tt.d, tt.timePkg); got != tt.want {
+				t.Errorf("durationLiteral(%v, %q) = %q, want %q", tt.d, tt.timePkg, got, tt.want)
+			}
+		})
+	}
+}
+
+const kindsSrc = `package p
+
+import "time"
+
+type (
+	Port    uint16
+	Timeout time.Duration
+	Ints    []int
+	Waits   []time.Duration
+	Struct  struct{}
+)
+`
+
+func TestDefaultExpr(t *testing.T) {
+	tests := []struct {
+		name    string
+		typ     string
+		value   string
+		sep     string
+		want    string
+		wantErr bool
+	}{
+		{name: "should pass; named scalar", typ: "Port", value: "8080", want: "8080"},
+		{name: "should fail; named scalar out of range", typ: "Port", value: "70000", wantErr: true},
+		{name: "should pass; time.Duration", typ: "time.Duration", value: "30s", want: "30 * time.Second"},
+		{name: "should pass; named duration", typ: "Timeout", value: "30s", want: "30000000000"},
+		{name: "should pass; comma separated slice", typ: "[]int", value: "[1,2,3]", sep: ",", want: "[]int{1, 2, 3}"},
+		{name: "should pass; bar separated slice", typ: "[]int", value: "1|2", sep: "|", want: "[]int{1, 2}"},
+		{name: "should pass; spaces around elements", typ: "[]string", value: "a, b", sep: ",", want: `[]string{"a", "b"}`},
+		{name: "should pass; empty slice", typ: "[]string", value: "[]", sep: ",", want: "[]string{}"},
+		{name: "should pass; named slice", typ: "Ints", value: "0x10|8", sep: "|", want: "Ints{16, 8}"},
+		{name: "should pass; duration slice", typ: "[]time.Duration", value: "1s|2m", sep: "|", want: "[]time.Duration{1 * time.Second, 2 * time.Minute}"},
+		{name: "should pass; named duration slice", typ: "Waits", value: "1s", sep: "|", want: "Waits{1000000000}"},
+		{name: "should fail; other separator", typ: "[]int", value: "1|2", sep: ",", wantErr: true},
+		{name: "should fail; invalid element", typ: "[]int", value: "1,x", sep: ",", wantErr: true},
+		{name: "should fail; array", typ: "[2]int", value: "1,2", sep: ",", wantErr: true},
+		{name: "should fail; map", typ: "map[string]int", value: "a", sep: ",", wantErr: true},
+		{name: "should fail; struct", typ: "Struct", value: "{}", wantErr: true},
+		{name: "should fail; slice of structs", typ: "[]Struct", value: "{}", sep: ",", wantErr: true},
+	}
+	pkg := loadTestPackage(t, kindsSrc)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := parser.ParseExpr(tt.typ)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := pkg.defaultExpr(pkg.Files[0], expr, tt.value, tt.sep)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("defaultExpr(%s, %q) error = %v, wantErr %v", tt.typ, tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("defaultExpr(%s, %q) = %q, want %q", tt.typ, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+const valueTypesSrc = `package p
+
+import (
+	. "sync"
+	"time"
+)
+
+type (
+	Mode   string
+	Names  []string
+	Config struct{}
+)
+
+var _ Mutex
+`
+
+func TestIsValueType(t *testing.T) {
+	tests := []struct {
+		name string
+		typ  string
+		want bool
+	}{
+		{name: "should pass; predeclared scalar", typ: "int", want: true},
+		{name: "should pass; duration", typ: "time.Duration", want: true},
+		{name: "should pass; named scalar", typ: "Mode", want: true},
+		{name: "should pass; named slice", typ: "Names", want: true},
+		{name: "should pass; slice", typ: "[]Config", want: true},
+		{name: "should pass; map", typ: "map[string]int", want: true},
+		{name: "should pass; struct", typ: "Config"},
+		{name: "should pass; type of another package", typ: "time.Time"},
+		{name: "should pass; type of a dot import", typ: "Mutex"},
+	}
+	pkg := loadTestPackage(t, valueTypesSrc)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := parser.ParseExpr(tt.typ)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := pkg.isValueType(pkg.Files[0], expr); got != tt.want {
+				t.Errorf("isValueType(%s) = %v, want %v", tt.typ, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Package is a parsed package directory. It doubles as the package-wide
+// symbol table, so that constructors and option names declared in one file
+// are visible while generating the options of another.
+type Package struct {
+	Dir   string
+	Name  string
+	Fset  *token.FileSet
+	Files []*File
+	// Generated holds the paths of the files genopts generated earlier.
+	Generated []string
+
+	// Types holds every top-level type declared in the package.
+	Types map[string]*ast.TypeSpec
+	// Funcs holds every top-level function (not method) in the package.
+	Funcs map[string]*ast.FuncDecl
+	// Values holds the names of every top-level variable and constant.
+	Values map[string]*ast.Ident
+	// Methods holds the methods of the package's types by receiver type
+	// name, regardless of whether the receiver is a pointer.
+	Methods map[string]map[string]*ast.FuncDecl
+
+	// Config holds the generator settings of the package.
+	Config *Config
+
+	// Qualifier is set on the packages loaded to promote the fields of
+	// their structs. It is the name the generated code refers to the package
+	// by, imported with QualifierImport.
+	Qualifier       string
+	QualifierImport Import
+
+	// generated holds the files other tools generated. Their declarations
+	// are part of the package, but genopts generates no options for them.
+	generated []*File
+
+	typeFiles map[string]*File
+	typeDocs  map[string]*ast.CommentGroup
+	imports   map[*File]*fileImports
+	deps      map[string]*Package
+}
+
+// File is a single source file of a Package.
+type File struct {
+	Path string
+	AST  *ast.File
+}
+
+// loadPackage parses every non-test Go file in dir that the build
+// constraints select for the current platform, except the files genopts
+// generated, which it notes. It returns nil when the directory holds no
+// files but those of other generators.
+func loadPackage(dir string) (*Package, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg := &Package{
+		Dir:    dir,
+		Fset:   token.NewFileSet(),
+		Types:  map[string]*ast.TypeSpec{},
+		Funcs:  map[string]*ast.FuncDecl{},
+		Values: map[string]*ast.Ident{},
+
+		Methods: map[string]map[string]*ast.FuncDecl{},
+
+		typeFiles: map[string]*File{},
+		typeDocs:  map[string]*ast.CommentGroup{},
+		imports:   map[*File]*fileImports{},
+		deps:      map[string]*Package{},
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		// Files excluded from the build by their constraints, such as
+		// //go:build ignore helpers, are not part of the package.
+		if ok, err := build.Default.MatchFile(dir, name); err != nil {
+			return nil, err
+		} else if !ok {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		node, err := parser.ParseFile(pkg.Fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if generatedByGenopts(node) {
+			pkg.Generated = append(pkg.Generated, path)
+			continue
+		}
+
+		if pkg.Name == "" {
+			pkg.Name = node.Name.Name
+		} else if pkg.Name != node.Name.Name {
+			return nil, fmt.Errorf("%s: found packages %s and %s", dir, pkg.Name, node.Name.Name)
+		}
+		if ast.IsGenerated(node) {
+			pkg.generated = append(pkg.generated, &File{Path: path, AST: node})
+			continue
+		}
+		pkg.Files = append(pkg.Files, &File{Path: path, AST: node})
+	}
+
+	if len(pkg.Files) == 0 && len(pkg.Generated) == 0 {
+		return nil, nil
+	}
+
+	// Keep the output independent of the order the directory was read in;
+	// option name collisions are resolved first come, first served.
+	sort.Slice(pkg.Files, func(i, j int) bool {
+		return pkg.Files[i].Path < pkg.Files[j].Path
+	})
+
+	for _, file := range slices.Concat(pkg.Files, pkg.generated) {
+		for _, decl := range file.AST.Decls {
+			switch d := decl.(type) {
+			case *ast.FuncDecl:
+				if d.Recv == nil {
+					pkg.Funcs[d.Name.Name] = d
+					continue
+				}
+				recv := receiverName(d.Recv.List[0].Type)
+				if pkg.Methods[recv] == nil {
+					pkg.Methods[recv] = map[string]*ast.FuncDecl{}
+				}
+				pkg.Methods[recv][d.Name.Name] = d
+			case *ast.GenDecl:
+				for _, spec := range d.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						pkg.Types[spec.Name.Name] = spec
+						pkg.typeFiles[spec.Name.Name] = file
+						pkg.typeDocs[spec.Name.Name] = typeDoc(d, spec)
+					case *ast.ValueSpec:
+						for _, name := range spec.Names {
+							if name.Name != "_" {
+								pkg.Values[name.Name] = name
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return pkg, nil
+}
+
+// declared returns the position of the top-level declaration of name in the
+// package, whether a type, function, variable or constant, and whether there
+// is one.
+func (p *Package) declared(name string) (token.Pos, bool) {
+	if ts, ok := p.Types[name]; ok {
+		return ts.Pos(), true
+	}
+	if fn, ok := p.Funcs[name]; ok {
+		return fn.Pos(), true
+	}
+	if ident, ok := p.Values[name]; ok {
+		return ident.Pos(), true
+	}
+	return token.NoPos, false
+}
+
+// File returns the package file at path, or nil if path is not part of the
+// package.
+func (p *Package) File(path string) *File {
+	for _, file := range p.Files {
+		if file.Path == path {
+			return file
+		}
+	}
+	return nil
+}
+
+// receiverName returns the name of the type of a method receiver, e.g. T for
+// *T or T[K, V].
+func receiverName(expr ast.Expr) string {
+	for {
+		switch t := expr.(type) {
+		case *ast.StarExpr:
+			expr = t.X
+		case *ast.ParenExpr:
+			expr = t.X
+		case *ast.IndexExpr:
+			expr = t.X
+		case *ast.IndexListExpr:
+			expr = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// HasMethod reports whether the type typeName has a method name that takes
+// no arguments and returns exactly results, e.g. "error". An empty results
+// matches a method without results.
+func (p *Package) HasMethod(typeName, name string, results ...string) bool {
+	fn, ok := p.Methods[typeName][name]
+	if !ok || fn.Type.Params.NumFields() != 0 || fn.Type.Results.NumFields() != len(results) {
+		return false
+	}
+	if fn.Type.Results == nil {
+		return true
+	}
+	i := 0
+	for _, field := range fn.Type.Results.List {
+		n := max(len(field.Names), 1)
+		for range n {
+			if exprString(field.Type) != results[i] {
+				return false
+			}
+			i++
+		}
+	}
+	return true
+}
+
+// Imports returns the import resolver of file.
+func (p *Package) Imports(file *File) *fileImports {
+	fi, ok := p.imports[file]
+	if !ok {
+		fi = newFileImports(p.Dir, file.AST)
+		p.imports[file] = fi
+	}
+	return fi
+}
+
+// expandPattern turns a -pkg pattern into the package directories it names.
+// A trailing "/..." walks every directory below the root, stopping at nested
+// modules and at directories the go tool ignores as well.
+func expandPattern(pattern string) ([]string, error) {
+	root, recursive := strings.CutSuffix(pattern, "...")
+	if recursive {
+		root = strings.TrimSuffix(root, "/")
+		if root == "" {
+			root = "."
+		}
+	}
+
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	if !recursive {
+		return []string{root}, nil
+	}
+
+	var dirs []string
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != root {
+			name := d.Name()
+			if strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" || name == "vendor" {
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+		}
+		dirs = append(dirs, path)
+		return nil
+	})
+	return dirs, err
+}
+
+// generatedByGenopts reports whether the generated file f was generated by
+// genopts, rather than by another tool.
+func generatedByGenopts(f *ast.File) bool {
+	for _, group := range f.Comments {
+		if group.Pos() >= f.Package {
+			break
+		}
+		for _, c := range group.List {
+			if c.Text == generatedComment {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -1,264 +1,2159 @@
-package main
-
-import (
-	"bytes"
-	"flag"
-	"go/ast"
-	"go/format"
-	"go/parser"
-	"go/token"
-	"log"
-	"os"
-	"path/filepath"
-	"strings"
-	"text/template"
-	"unicode"
-
-	"golang.org/x/text/cases"
-	"golang.org/x/text/language"
-)
-
-var filename = flag.String("file", "", "Source file to process")
-
-func main() {
-	flag.Parse()
-	if *filename == "" {
-		log.Fatal("Missing -file flag")
-	}
-
-	cwd, err := os.Getwd()
-	if err != nil {
-		log.Fatal(err)
-	}
-	filePath := filepath.Join(cwd, *filename)
-
-	src, err := os.ReadFile(filePath)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	fset := token.NewFileSet()
-	node, err := parser.ParseFile(fset, filePath, src, parser.ParseComments)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	pkgName := node.Name.Name
-	constructors := map[string]bool{}
-
-	for _, decl := range node.Decls {
-		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && strings.HasPrefix(fn.Name.Name, "New") {
-			constructors[fn.Name.Name] = true
-		}
-	}
-
-	var structs []StructData
-
-	fieldsCheck := map[string]map[string]struct{}{}
-	for _, decl := range node.Decls {
-		genDecl, ok := decl.(*ast.GenDecl)
-		if !ok || genDecl.Tok != token.TYPE {
-			continue
-		}
-
-		for _, spec := range genDecl.Specs {
-			ts, ok := spec.(*ast.TypeSpec)
-			if !ok {
-				continue
-			}
-			st, ok := ts.Type.(*ast.StructType)
-			if !ok {
-				continue
-			}
-			var fields []Field
-			for _, field := range st.Fields.List {
-				if field.Tag == nil {
-					continue
-				}
-				tag := strings.Trim(field.Tag.Value, "`")
-				if strings.Contains(tag, `with:"-"`) {
-					for _, name := range field.Names {
-						_, ok := fieldsCheck[name.Name]
-						if ok {
-							fieldsCheck[name.Name][ts.Name.Name] = struct{}{}
-						} else {
-							fieldsCheck[name.Name] = map[string]struct{}{
-								ts.Name.Name: {},
-							}
-						}
-
-						fields = append(fields, Field{
-							Name: name.Name,
-							Type: exprString(field.Type),
-						})
-					}
-				}
-			}
-
-			if len(fields) == 0 {
-				continue
-			}
-
-			// Check if there are any field duplications across the other struts.
-			// If so we need to prepend a struct name to the with func: ${StructName}_With${FieldName}
-
-			hasFieldDuplicationAcrossStructsInPackage := false
-			for _, field := range fields {
-				if structs, ok := fieldsCheck[field.Name]; ok && len(structs) > 1 {
-					if _, ok := structs[ts.Name.Name]; ok {
-						hasFieldDuplicationAcrossStructsInPackage = true
-					}
-				}
-			}
-
-			structName := ts.Name.Name
-			optionName := structName + "Option"
-			funcName := toCamelCase(structName) + "OptionFunc"
-			ctorName := "New" + structName
-			structs = append(structs, StructData{
-				Name:        structName,
-				OptionName:  optionName,
-				FuncName:    funcName,
-				OptionType:  ctorName,
-				Fields:      fields,
-				HasCtorFunc: constructors[ctorName],
-				HasFieldDup: hasFieldDuplicationAcrossStructsInPackage,
-			})
-		}
-	}
-
-	if len(structs) == 0 {
-		return
-	}
-
-	outputFile := strings.TrimSuffix(filePath, ".go") + ".gen.go"
-	out, err := os.Create(outputFile)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer out.Close()
-
-	tmpl := template.Must(template.New("code").Funcs(template.FuncMap{
-		"toStartCase": toStartCase,
-	}).Parse(tmplSrc))
-
-	var buf bytes.Buffer
-	data := struct {
-		Package string
-		Structs []StructData
-	}{
-		Package: pkgName,
-		Structs: structs,
-	}
-
-	err = tmpl.Execute(&buf, data)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	formatted, err := format.Source(buf.Bytes())
-	if err != nil {
-		log.Fatalf("failed to format: %v", err)
-	}
-	_, err = out.Write(formatted)
-	if err != nil {
-		log.Fatal(err)
-	}
-}
-
-type Field struct {
-	Name string
-	Type string
-}
-
-type StructData struct {
-	Name        string
-	OptionName  string
-	FuncName    string
-	OptionType  string
-	Fields      []Field
-	HasCtorFunc bool
-	HasFieldDup bool
-}
-
-func exprString(e ast.Expr) string {
-	var buf bytes.Buffer
-	_ = format.Node(&buf, token.NewFileSet(), e)
-	return buf.String()
-}
-
-const tmplSrc = `// Code generated by generateopts; DO NOT EDIT.
-
-package {{.Package}}
-
-{{range .Structs}}
-type {{.OptionName}} interface {
-	apply(*{{.Name}}) error
-}
-
-type {{.FuncName}} func(*{{.Name}}) error
-
-func (f {{.FuncName}}) apply(s *{{.Name}}) error {
-	return f(s)
-}
-
-{{- $optName := .OptionName -}}
-{{- $funcName := .FuncName -}}
-{{- $structName := .Name -}}
-{{- $hasFieldDup := .HasFieldDup -}}
-
-{{range .Fields}}
-
-func {{if $hasFieldDup}}{{$structName}}_{{end -}}With{{toStartCase .Name}}(v {{.Type}}) {{$optName}} {
-	return {{$funcName}}(func(s *{{$structName}}) error {
-		s.{{.Name}} = v
-		return nil
-	})
-}
-{{end}}
-
-{{if not .HasCtorFunc}}
-func {{.OptionType}}(opts ...{{.OptionName}}) (*{{.Name}}, error) {
-	obj := &{{.Name}}{}
-	for _, opt := range opts {
-		if err := opt.apply(obj); err != nil {
-			return nil, err
-		}
-	}
-	return obj, nil
-}
-{{end}}
-
-{{end}}`
-
-// TODO: make a unit test compairing the start and camel case funcs
-func toStartCase(s string, opts ...language.Tag) string {
-	return cases.Title(language.English, cases.NoLower).String(s)
-}
-
-func toCamelCase(str string) string {
-	if str == "" {
-		return ""
-	}
-
-	// Remove separators and normalize chunks
-	words := strings.FieldsFunc(str, func(r rune) bool {
-		return r == '_' || r == '-' || unicode.IsSpace(r)
-	})
-
-	if len(words) == 0 {
-		return ""
-	}
-
-	// First word: lowercase first letter, preserve rest
-	first := []rune(words[0])
-	first[0] = unicode.ToLower(first[0])
-	result := string(first)
-
-	// Append subsequent words exactly as-is
-	for _, word := range words[1:] {
-		result += word
-	}
-
-	return result
-}
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+var (
+	filename   = flag.String("file", "", "Source file to process, absolute or relative to the working directory")
+	pkgPattern = flag.String("pkg", "", "Package directory to process; a trailing /... processes every package below it")
+	perPackage = flag.Bool("per-package", false, "Write one genopts.gen.go per package instead of one .gen.go per source file")
+	aggregate  = flag.Bool("aggregate", false, "Apply every option and join their errors instead of stopping at the first; per struct with //genopts:aggregate")
+	flags      = flag.Bool("flags", false, "Also generate a Register<Struct>Flags function for every struct; per struct with //genopts:flags or a flag tag")
+	decode     = flag.String("decode", "", "Also generate <Struct>OptionsFromJSON and <Struct>OptionsFromYAML for every struct, for the formats listed, as in json,yaml; per struct with //genopts:decode=...")
+	immutable  = flag.Bool("immutable", false, "Also generate value methods that return a modified copy of every struct, as in u.WithName(\"x\"); per struct with //genopts:immutable")
+	builder    = flag.Bool("builder", false, "Also generate a builder type for every struct, as in NewUserBuilder().Name(\"x\").Build(); per struct with //genopts:builder")
+	initialism = flag.String("initialisms", "", "Comma-separated initialisms to spell in all caps in option names, in addition to the common ones such as ID and URL")
+
+	// These override the settings of .genopts.yaml; see Config.
+	namePrefix   = flag.String("name-prefix", "With", "Prefix of option names; per struct with //genopts:prefix=...")
+	nameSuffix   = flag.String("name-suffix", "", "Suffix of option names; per struct with //genopts:suffix=...")
+	collisions   = flag.String("collisions", "prefix", "What to do when an option name is taken by another struct: prefix it with the struct name or report an error")
+	outputSuffix = flag.String("suffix", ".gen.go", "Replaces .go in the names of generated files")
+	tagKey       = flag.String("tag", "with", "Struct tag key of the options")
+	header       = flag.String("header", "", "Comment text written at the top of generated files")
+
+	check  = flag.Bool("check", false, "Print a unified diff of the generated files that are out of date or stale instead of writing them, and exit with status 1 if there are any")
+	outDir = flag.String("out", "", "Write the generated files into this directory instead of next to their sources, or, when it names a .go file, all generated code of the package into that file")
+	stdout = flag.Bool("stdout", false, "Print the generated files instead of writing them")
+)
+
+func main() {
+	flag.Parse()
+	if *filename == "" && *pkgPattern == "" {
+		log.Fatal("Missing -file or -pkg flag")
+	}
+
+	out := &outputs{stdout: *stdout}
+	if strings.HasSuffix(*outDir, ".go") {
+		out.file = *outDir
+	} else {
+		out.dir = *outDir
+	}
+	if *pkgPattern != "" {
+		dirs, err := expandPattern(*pkgPattern)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, dir := range dirs {
+			pkg, err := loadPackage(dir)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if pkg == nil {
+				continue
+			}
+			if err := configure(pkg); err != nil {
+				log.Fatal(err)
+			}
+			if err := generatePackage(pkg, out); err != nil {
+				log.Fatal(err)
+			}
+		}
+	} else {
+		filePath, err := filepath.Abs(*filename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := generateFile(filePath, out); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *check {
+		upToDate, err := out.check(os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !upToDate {
+			os.Exit(1)
+		}
+		return
+	}
+	if err := out.write(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// generateFile generates the options of the structs in the source file at
+// filePath.
+func generateFile(filePath string, out *outputs) error {
+	pkg, err := loadPackage(filepath.Dir(filePath))
+	if err != nil {
+		return err
+	}
+	var file *File
+	if pkg != nil {
+		file = pkg.File(filePath)
+	}
+	if file == nil {
+		return fmt.Errorf("%s: not a source file of its package", filePath)
+	}
+	if err := configure(pkg); err != nil {
+		return err
+	}
+
+	byFile, err := collectStructs(pkg)
+	if err != nil {
+		return err
+	}
+	structs := byFile[file.Path]
+	if out.file != "" {
+		if len(structs) == 0 {
+			return nil
+		}
+		return out.generate(out.file, pkg, structs, needsHelpers(structs))
+	}
+	// The helpers are shared with the structs of the other files, whose
+	// code may need more of them.
+	helpers, err := packageHelpers(pkg, byFile)
+	if err != nil {
+		return err
+	}
+
+	output := pkg.Config.output(filePath)
+	if len(structs) > 0 {
+		if err := out.generate(output, pkg, structs, helperSet{}); err != nil {
+			return err
+		}
+	} else if slices.Contains(pkg.Generated, output) {
+		out.markStale(output)
+	}
+	helpersOutput := pkg.Config.packageOutput(pkg.Dir)
+	if helpers.needed() {
+		return out.generate(helpersOutput, pkg, nil, helpers)
+	}
+	if slices.Contains(pkg.Generated, helpersOutput) {
+		out.markStale(helpersOutput)
+	}
+	return nil
+}
+
+// configure loads the configuration of pkg.
+func configure(pkg *Package) error {
+	cfg, err := loadConfig(pkg.Dir)
+	if err != nil {
+		return err
+	}
+	pkg.Config = cfg
+	resetInitialisms(cfg.Initialisms...)
+	return nil
+}
+
+// generatePackage generates the options of every struct in pkg, either next
+// to each source file or into a single file when -per-package is set. The
+// files generated for pkg earlier that are not generated again are stale.
+func generatePackage(pkg *Package, out *outputs) error {
+	byFile, err := collectStructs(pkg)
+	if err != nil {
+		return err
+	}
+	defer out.markStale(pkg.Generated...)
+
+	helpers, err := packageHelpers(pkg, byFile)
+	if err != nil {
+		return err
+	}
+	if *perPackage || out.file != "" {
+		var structs []StructData
+		for _, file := range pkg.Files {
+			structs = append(structs, byFile[file.Path]...)
+		}
+		if len(structs) == 0 {
+			return nil
+		}
+		path := pkg.Config.packageOutput(pkg.Dir)
+		if out.file != "" {
+			path = out.file
+		}
+		return out.generate(path, pkg, structs, helpers)
+	}
+
+	for _, file := range pkg.Files {
+		structs := byFile[file.Path]
+		if len(structs) == 0 {
+			continue
+		}
+		if err := out.generate(pkg.Config.output(file.Path), pkg, structs, helperSet{}); err != nil {
+			return err
+		}
+	}
+	if helpers.needed() {
+		return out.generate(pkg.Config.packageOutput(pkg.Dir), pkg, nil, helpers)
+	}
+	return nil
+}
+
+// helperSet is the set of the declarations shared by the whole package that
+// the generated code of its structs refers to.
+type helperSet struct {
+	// Rules is RuleError, for the options of fields with rules.
+	Rules bool
+	// Fields is FieldError, namesField and nestFieldError, for aggregated
+	// errors and nested options.
+	Fields bool
+	// Keys is ErrUnknownKey, KeyError and nestKeyError, for decoding.
+	Keys bool
+	// JSONDurations is decodeJSONDuration and decodeJSONDurations, and
+	// YAMLDurations decodeYAMLDuration and decodeYAMLDurations, for the
+	// durations of documents.
+	JSONDurations bool
+	YAMLDurations bool
+}
+
+// needed reports whether any helper is needed.
+func (h helperSet) needed() bool {
+	return h.Rules || h.Fields || h.Keys || h.JSONDurations || h.YAMLDurations
+}
+
+// names returns the names the helpers declare.
+func (h helperSet) names() []string {
+	var names []string
+	if h.Rules {
+		names = append(names, "RuleError")
+	}
+	if h.Fields {
+		names = append(names, "FieldError", "namesField", "nestFieldError")
+	}
+	if h.Keys {
+		names = append(names, "ErrUnknownKey", "KeyError", "nestKeyError")
+	}
+	if h.JSONDurations {
+		names = append(names, "decodeJSONDuration", "decodeJSONDurations")
+	}
+	if h.YAMLDurations {
+		names = append(names, "decodeYAMLDuration", "decodeYAMLDurations")
+	}
+	return names
+}
+
+// imports returns the imports of the helpers.
+func (h helperSet) imports() []Import {
+	var imports []Import
+	if h.Rules {
+		imports = append(imports, Import{Path: "fmt"})
+	}
+	if h.Fields {
+		imports = append(imports, Import{Path: "errors"}, Import{Path: "strings"})
+	}
+	if h.Keys {
+		imports = append(imports, Import{Path: "errors"})
+	}
+	if h.JSONDurations {
+		imports = append(imports, Import{Path: "encoding/json"}, Import{Path: "time"})
+	}
+	if h.YAMLDurations {
+		imports = append(imports, Import{Path: "fmt"}, Import{Path: "gopkg.in/yaml.v3"}, Import{Path: "time"})
+	}
+	return imports
+}
+
+// needsHelpers returns the helpers the generated code of structs refers to.
+func needsHelpers(structs []StructData) helperSet {
+	var h helperSet
+	for _, st := range structs {
+		h.Rules = h.Rules || st.hasRules()
+		h.Fields = h.Fields || st.HasNested() || st.Aggregate
+		h.Keys = h.Keys || st.DecodeJSON || st.DecodeYAML
+		for _, f := range st.Fields {
+			h.JSONDurations = h.JSONDurations || st.DecodeJSON && f.JSONKey != "-" && f.Duration != ""
+			h.YAMLDurations = h.YAMLDurations || st.DecodeYAML && f.YAMLKey != "-" && f.Duration != ""
+		}
+	}
+	return h
+}
+
+// packageHelpers returns the helpers the generated code of the structs of
+// pkg refers to. It reports an error when the package declares one of their
+// names already.
+func packageHelpers(pkg *Package, byFile map[string][]StructData) (helperSet, error) {
+	var structs []StructData
+	for _, file := range pkg.Files {
+		structs = append(structs, byFile[file.Path]...)
+	}
+	h := needsHelpers(structs)
+	for _, name := range h.names() {
+		pos, ok := pkg.declared(name)
+		if !ok {
+			continue
+		}
+		return helperSet{}, fmt.Errorf("%s: %s is declared by the package already, and the generated options need it", pkg.Fset.Position(pos), name)
+	}
+	return h, nil
+}
+
+// collectStructs finds the structs with tagged fields in every file of pkg,
+// keyed by file path. Constructors and field names are looked up across the
+// whole package, so a NewUser or a duplicate WithName in a sibling file is
+// taken into account.
+func collectStructs(pkg *Package) (map[string][]StructData, error) {
+	byFile := map[string][]StructData{}
+
+	fieldsCheck := map[string]map[string]struct{}{}
+	optionFuncs := map[string]string{}
+	for _, file := range pkg.Files {
+		for _, decl := range file.AST.Decls {
+			genDecl, ok := decl.(*ast.GenDecl)
+			if !ok || genDecl.Tok != token.TYPE {
+				continue
+			}
+
+			for _, spec := range genDecl.Specs {
+				ts, ok := spec.(*ast.TypeSpec)
+				if !ok {
+					continue
+				}
+				st, ok := ts.Type.(*ast.StructType)
+				if !ok {
+					continue
+				}
+				typeParams, err := pkg.typeParams(file, ts)
+				if err != nil {
+					return nil, err
+				}
+				scope := map[string]bool{}
+				for _, name := range typeParams.Names {
+					scope[name] = true
+				}
+
+				doc := typeDoc(genDecl, ts)
+				optPrefix, optSuffix := pkg.Config.Prefix, pkg.Config.Suffix
+				if v, ok := directiveValue(doc, "prefix"); ok {
+					optPrefix = v
+				}
+				if v, ok := directiveValue(doc, "suffix"); ok {
+					optSuffix = v
+				}
+				if !token.IsIdentifier(optPrefix + "X" + optSuffix) {
+					return nil, fmt.Errorf("%s: prefix %q and suffix %q of %s do not make identifiers", pkg.Fset.Position(ts.Pos()), optPrefix, optSuffix, ts.Name.Name)
+				}
+				optFunc := func(f Field) string {
+					return optPrefix + toStartCase(f.OptName) + optSuffix
+				}
+
+				all := hasDirective(doc, "generate")
+				fields, err := pkg.structFields(file, ts.Name.Name, st, all, scope, embedding{}, map[string]bool{})
+				if err != nil {
+					return nil, err
+				}
+				for _, f := range fields {
+					if f.FuncName != "" {
+						if err := checkFuncName(pkg, f); err != nil {
+							return nil, err
+						}
+						if f.Append == "" {
+							// No option name is derived from OptName.
+							continue
+						}
+					}
+					if _, ok := fieldsCheck[optFunc(f)]; ok {
+						fieldsCheck[optFunc(f)][ts.Name.Name] = struct{}{}
+					} else {
+						fieldsCheck[optFunc(f)] = map[string]struct{}{
+							ts.Name.Name: {},
+						}
+					}
+				}
+
+				if len(fields) == 0 {
+					continue
+				}
+
+				// Check if there are any field duplications across the other struts.
+				// If so we need to prepend a struct name to the with func: ${StructName}_With${FieldName}
+
+				hasFieldDuplicationAcrossStructsInPackage := false
+				for _, field := range fields {
+					if field.FuncName != "" && field.Append == "" {
+						continue
+					}
+					if structs, ok := fieldsCheck[optFunc(field)]; ok && len(structs) > 1 {
+						if _, ok := structs[ts.Name.Name]; ok {
+							hasFieldDuplicationAcrossStructsInPackage = true
+							if pkg.Config.Collisions == "error" {
+								return nil, fmt.Errorf("%s: option %s of %s is taken by another struct; choose another name in the %s tag", pkg.Fset.Position(field.pos), optFunc(field), ts.Name.Name, pkg.Config.Tag)
+							}
+						}
+					}
+				}
+
+				dupPrefix := ""
+				if hasFieldDuplicationAcrossStructsInPackage {
+					dupPrefix = ts.Name.Name + "_"
+				}
+				nameOptionFuncs(fields, dupPrefix, optPrefix, optSuffix)
+				// Names declared by the package are taken like other
+				// structs' options do.
+				if f, name, ok := declaredOptionFunc(pkg, fields); ok {
+					if pkg.Config.Collisions == "error" || dupPrefix != "" {
+						return nil, fmt.Errorf("%s: option %s of %s is declared by the package already; choose another name in the %s tag", pkg.Fset.Position(f.pos), name, ts.Name.Name, pkg.Config.Tag)
+					}
+					hasFieldDuplicationAcrossStructsInPackage = true
+					dupPrefix = ts.Name.Name + "_"
+					nameOptionFuncs(fields, dupPrefix, optPrefix, optSuffix)
+					if f, name, ok := declaredOptionFunc(pkg, fields); ok {
+						return nil, fmt.Errorf("%s: option %s of %s is declared by the package already; choose another name in the %s tag", pkg.Fset.Position(f.pos), name, ts.Name.Name, pkg.Config.Tag)
+					}
+				}
+				if err := checkOptionFuncs(pkg, optionFuncs, ts, fields); err != nil {
+					return nil, err
+				}
+
+				structName := ts.Name.Name
+				builder := pkg.Config.Builder || hasDirective(doc, "builder")
+				if builder {
+					if err := checkBuilder(pkg, ts, typeParams.Args(), fields); err != nil {
+						return nil, err
+					}
+				}
+				for _, f := range fields {
+					if f.Env == "" {
+						continue
+					}
+					if _, ok := pkg.declared(ts.Name.Name + "OptionsFromEnv"); ok {
+						return nil, fmt.Errorf("%s: %sOptionsFromEnv is declared by the package already", pkg.Fset.Position(ts.Pos()), ts.Name.Name)
+					}
+					break
+				}
+				flags := pkg.Config.Flags || hasDirective(doc, "flags")
+				for _, f := range fields {
+					flags = flags || f.flagTagged
+				}
+				if flags {
+					if err := checkFlags(pkg, ts, fields); err != nil {
+						return nil, err
+					}
+				}
+				formats, err := decodeFormats(doc, pkg.Config)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", pkg.Fset.Position(ts.Pos()), err)
+				}
+				if len(formats) > 0 {
+					if err := checkDecode(pkg, ts, fields, formats); err != nil {
+						return nil, err
+					}
+				}
+				setField := fieldSetField(st, toCamelCase(structName)+"FieldSet")
+				if setField != "" && (pkg.Methods[structName]["IsSet"] != nil || hasField(st, "IsSet")) {
+					return nil, fmt.Errorf("%s: %s has an IsSet method or field already, so %s cannot record the fields options set", pkg.Fset.Position(ts.Pos()), structName, setField)
+				}
+				immutable := pkg.Config.Immutable || hasDirective(doc, "immutable")
+				if immutable {
+					if err := checkImmutable(pkg, ts, st, fields); err != nil {
+						return nil, err
+					}
+				}
+				optionName := structName + "Option"
+				funcName := toCamelCase(structName) + "OptionFunc"
+				fieldOptionName := toCamelCase(structName) + "FieldOption"
+				ctorName := "New" + structName
+				_, hasCtor := pkg.Funcs[ctorName]
+				data := StructData{
+					Name:            structName,
+					TypeParams:      typeParams.Decl,
+					TypeArgs:        typeParams.Args(),
+					ParamImports:    typeParams.Imports,
+					OptionName:      optionName,
+					FuncName:        funcName,
+					FieldOptionName: fieldOptionName,
+					OptionType:      ctorName,
+					Fields:          fields,
+					HasCtorFunc:     hasCtor,
+					HasFieldDup:     hasFieldDuplicationAcrossStructsInPackage,
+					HasApply:        pkg.Methods[structName]["Apply"] != nil || hasField(st, "Apply"),
+					Aggregate:       pkg.Config.Aggregate || hasDirective(doc, "aggregate"),
+					Flags:           flags,
+					DecodeJSON:      slices.Contains(formats, formatJSON),
+					DecodeYAML:      slices.Contains(formats, formatYAML),
+					DocumentName:    toCamelCase(structName) + "Document",
+					Immutable:       immutable,
+					SetField:        setField,
+					FieldSetName:    toCamelCase(structName) + "FieldSet",
+					Builder:         builder,
+					BuilderName:     structName + "Builder",
+					HasValidate:     pkg.HasMethod(structName, "Validate", "error"),
+					HasPostInit:     pkg.HasMethod(structName, "PostInit"),
+					HasPostInitErr:  pkg.HasMethod(structName, "PostInit", "error"),
+				}
+				for _, name := range data.declNames() {
+					if _, ok := pkg.declared(name); ok {
+						return nil, fmt.Errorf("%s: %s is declared by the package already", pkg.Fset.Position(ts.Pos()), name)
+					}
+				}
+				byFile[file.Path] = append(byFile[file.Path], data)
+			}
+		}
+	}
+
+	if err := resolveNested(pkg, byFile); err != nil {
+		return nil, err
+	}
+	if err := resolveDecode(pkg, byFile); err != nil {
+		return nil, err
+	}
+	return byFile, nil
+}
+
+// checkBuilder reports an error when the builder of the struct ts cannot be
+// generated: its names are taken, or two of its methods would share a name.
+func checkBuilder(pkg *Package, ts *ast.TypeSpec, typeArgs string, fields []Field) error {
+	name := ts.Name.Name + "Builder"
+	// Build calls the constructor, which may be written by hand.
+	if ctor, ok := pkg.Funcs["New"+ts.Name.Name]; ok && !isOptionCtor(ctor.Type, ts.Name.Name, typeArgs) {
+		return fmt.Errorf("%s: %s needs New%[3]s(opts ...%[3]sOption%[4]s) (*%[3]s%[4]s, error), which Build calls", pkg.Fset.Position(ctor.Pos()), name, ts.Name.Name, typeArgs)
+	}
+	if _, ok := pkg.declared(name); ok {
+		return fmt.Errorf("%s: %s is declared by the package already", pkg.Fset.Position(ts.Pos()), name)
+	}
+	if _, ok := pkg.declared("New" + name); ok {
+		return fmt.Errorf("%s: New%s is declared by the package already", pkg.Fset.Position(ts.Pos()), name)
+	}
+	methods := map[string]bool{"Build": true}
+	for _, f := range fields {
+		names := []string{toStartCase(f.OptName)}
+		switch f.Append {
+		case "slice":
+			names = append(names, "Add"+toStartCase(f.OptName))
+		case "map":
+			names = append(names, toStartCase(f.OptName)+"Entry")
+		}
+		for _, method := range names {
+			if methods[method] {
+				return fmt.Errorf("%s: builder method %s of %s is taken; choose another name in the %s tag", pkg.Fset.Position(f.pos), method, name, pkg.Config.Tag)
+			}
+			methods[method] = true
+		}
+	}
+	return nil
+}
+
+// checkFlags names the flags of the fields of the struct ts that have none
+// chosen by their flag tag, and reports an error when two fields would
+// share a flag or Register<Struct>Flags is declared already.
+func checkFlags(pkg *Package, ts *ast.TypeSpec, fields []Field) error {
+	if _, ok := pkg.declared("Register" + ts.Name.Name + "Flags"); ok {
+		return fmt.Errorf("%s: Register%sFlags is declared by the package already", pkg.Fset.Position(ts.Pos()), ts.Name.Name)
+	}
+	names := map[string]string{}
+	for i, f := range fields {
+		if f.FlagParse == "" {
+			continue
+		}
+		if f.Flag == "" {
+			fields[i].Flag = flagName(f.OptName)
+		}
+		if other, ok := names[fields[i].Flag]; ok {
+			return fmt.Errorf("%s: flag %s of %s is taken by %s; choose another name in the %s tag", pkg.Fset.Position(f.pos), fields[i].Flag, ts.Name.Name, other, flagTag)
+		}
+		names[fields[i].Flag] = f.Path
+	}
+	return nil
+}
+
+// fieldSetField returns the name of the field of st of type typeName, in
+// which the options record the fields they set, or "" when it has none.
+func fieldSetField(st *ast.StructType, typeName string) string {
+	for _, field := range st.Fields.List {
+		if ident, ok := field.Type.(*ast.Ident); ok && ident.Name == typeName && len(field.Names) == 1 {
+			return field.Names[0].Name
+		}
+	}
+	return ""
+}
+
+// checkImmutable reports an error when the immutable methods of the struct
+// ts cannot be generated: a field or method of the struct has their name,
+// two of them would share a name, or one sets a field through an embedded
+// pointer, which the copy would share.
+func checkImmutable(pkg *Package, ts *ast.TypeSpec, st *ast.StructType, fields []Field) error {
+	name := ts.Name.Name
+	methods := map[string]bool{"Apply": true}
+	for _, f := range fields {
+		if len(f.allocs) > 0 {
+			return fmt.Errorf("%s: immutable methods of %s cannot set %s through the embedded pointer %s", pkg.Fset.Position(f.pos), name, f.Path, f.allocs[0].Path)
+		}
+		names := []string{f.WithMethod}
+		switch f.Append {
+		case "slice":
+			names = append(names, f.AddMethod)
+		case "map":
+			names = append(names, f.EntryMethod)
+		}
+		for _, method := range names {
+			if methods[method] || pkg.Methods[name][method] != nil || hasField(st, method) {
+				return fmt.Errorf("%s: method %s of %s is taken; choose another name in the %s tag", pkg.Fset.Position(f.pos), method, name, pkg.Config.Tag)
+			}
+			methods[method] = true
+		}
+	}
+	return nil
+}
+
+// nameOptionFuncs names the option functions of fields and the immutable
+// methods after them. dupPrefix prefixes the functions of structs whose
+// option names collide with others.
+func nameOptionFuncs(fields []Field, dupPrefix, optPrefix, optSuffix string) {
+	for i := range fields {
+		name := toStartCase(fields[i].OptName)
+		fields[i].WithFunc = dupPrefix + optPrefix + name + optSuffix
+		if fields[i].FuncName != "" {
+			fields[i].WithFunc = fields[i].FuncName
+		}
+		fields[i].AddFunc = dupPrefix + "Add" + name + optSuffix
+		fields[i].EntryFunc = dupPrefix + optPrefix + name + "Entry" + optSuffix
+		fields[i].WithMethod = strings.TrimPrefix(fields[i].WithFunc, dupPrefix)
+		fields[i].AddMethod = strings.TrimPrefix(fields[i].AddFunc, dupPrefix)
+		fields[i].EntryMethod = strings.TrimPrefix(fields[i].EntryFunc, dupPrefix)
+	}
+}
+
+// declaredOptionFunc returns the first field with an option function whose
+// name derives from the field and is declared by pkg, and that name. The
+// names chosen by with tags are checked by checkFuncName, and names taken
+// twice by checkOptionFuncs.
+func declaredOptionFunc(pkg *Package, fields []Field) (Field, string, bool) {
+	for _, f := range fields {
+		var names []string
+		if f.FuncName == "" {
+			names = append(names, f.WithFunc)
+		}
+		switch f.Append {
+		case "slice":
+			names = append(names, f.AddFunc)
+		case "map":
+			names = append(names, f.EntryFunc)
+		}
+		for _, name := range names {
+			if _, ok := pkg.declared(name); ok {
+				return f, name, true
+			}
+		}
+	}
+	return Field{}, "", false
+}
+
+// isOptionCtor reports whether fn is the type of a constructor that takes
+// the options of the struct name and returns it and an error, like the
+// generated ones.
+func isOptionCtor(fn *ast.FuncType, name, typeArgs string) bool {
+	params, results := fn.Params.List, fn.Results
+	if len(params) != 1 || len(params[0].Names) > 1 || results == nil || results.NumFields() != 2 || len(results.List) != 2 {
+		return false
+	}
+	ellipsis, ok := params[0].Type.(*ast.Ellipsis)
+	return ok && exprString(ellipsis.Elt) == name+"Option"+typeArgs &&
+		exprString(results.List[0].Type) == "*"+name+typeArgs && exprString(results.List[1].Type) == "error"
+}
+
+// checkFuncName reports an error when the option function name the with tag
+// of f chooses is declared by the package already.
+func checkFuncName(pkg *Package, f Field) error {
+	if _, ok := pkg.declared(f.FuncName); ok {
+		return fmt.Errorf("%s: option name %s is declared by the package already", pkg.Fset.Position(f.pos), f.FuncName)
+	}
+	return nil
+}
+
+// checkOptionFuncs reports an error when an option function of the fields
+// of the struct ts takes the name of another one, of the same struct or of
+// another. taken maps the names of the option functions so far to the
+// fields they set, as in "Server.Port".
+func checkOptionFuncs(pkg *Package, taken map[string]string, ts *ast.TypeSpec, fields []Field) error {
+	for _, f := range fields {
+		// Fields promoted from other packages were parsed into their own
+		// file sets.
+		pos := f.pos
+		if f.depth > 0 {
+			pos = ts.Pos()
+		}
+		for _, name := range f.optionFuncs() {
+			if other, ok := taken[name]; ok {
+				return fmt.Errorf("%s: option %s of %s.%s is taken by %s; choose another name in the %s tag", pkg.Fset.Position(pos), name, ts.Name.Name, f.Path, other, pkg.Config.Tag)
+			}
+			taken[name] = ts.Name.Name + "." + f.Path
+		}
+	}
+	return nil
+}
+
+// fieldData describes the options of a tagged field of the struct
+// structName, one Field per name the field declares. via is the chain of
+// embedded fields the field is promoted through, if any.
+func (p *Package) fieldData(file *File, structName string, field *ast.Field, wt withTag, scope map[string]bool, via embedding) ([]Field, error) {
+	fieldImports, err := p.Imports(file).uses(p, field.Type, scope)
+	if err != nil {
+		return nil, err
+	}
+	fieldImports = append(fieldImports, via.imports...)
+	env, err := envName(field)
+	if err != nil {
+		return nil, err
+	}
+	flagTags, err := lookupFlag(field)
+	if err != nil {
+		return nil, err
+	}
+	if wt.flags["nested"] {
+		if env != "" {
+			return nil, fmt.Errorf("env is not supported for nested fields")
+		}
+		if flagTags.tagged && flagTags.name != "-" {
+			return nil, fmt.Errorf("flag is not supported for nested fields")
+		}
+		return p.nestedFields(field, wt, via)
+	}
+
+	var def string
+	if value, sep, ok := defaultValue(field, wt); ok {
+		def, err = p.defaultExpr(file, field.Type, value, sep)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.checkDefault(file, field.Type, wt.parts, value, sep); err != nil {
+			return nil, err
+		}
+	}
+
+	var appendMode string
+	var elemType, keyType, valueType string
+	if wt.flags["append"] {
+		typeFile, typ := p.underlying(file, field.Type)
+		var typeImports []Import
+		switch t := typ.(type) {
+		case *ast.ArrayType:
+			if t.Len != nil {
+				return nil, fmt.Errorf("append needs a slice or map field")
+			}
+			appendMode = "slice"
+			elemType, typeImports, err = p.typeIn(typeFile, t.Elt, scope)
+		case *ast.MapType:
+			appendMode = "map"
+			var keyImports []Import
+			if keyType, keyImports, err = p.typeIn(typeFile, t.Key, scope); err != nil {
+				return nil, err
+			}
+			valueType, typeImports, err = p.typeIn(typeFile, t.Value, scope)
+			typeImports = append(typeImports, keyImports...)
+		default:
+			return nil, fmt.Errorf("append needs a slice or map field")
+		}
+		if err != nil {
+			return nil, err
+		}
+		fieldImports = append(fieldImports, typeImports...)
+	}
+
+	// The immutable methods clone slices and maps, so that copies of the
+	// struct do not share them.
+	var clone string
+	_, typ := p.underlying(file, field.Type)
+	switch t := typ.(type) {
+	case *ast.ArrayType:
+		if t.Len == nil {
+			clone = "slices"
+		}
+	case *ast.MapType:
+		clone = "maps"
+	}
+
+	// Pointer fields take the value they point to, unless that is a struct
+	// or a type of another package whose identity may matter.
+	param, depth := field.Type, 0
+	if !wt.flags["ptr"] {
+		elem, n := derefType(field.Type)
+		if n > 0 && (wt.flags["value"] || p.isValueType(file, elem)) {
+			param, depth = elem, n
+		}
+	}
+
+	var envCode string
+	var envImports []Import
+	if env != "" {
+		if len(field.Names) > 1 {
+			return nil, fmt.Errorf("env names a single field")
+		}
+		if envCode, envImports, err = p.envParse(file, param, env, scope); err != nil {
+			return nil, err
+		}
+	}
+
+	// The flag package reports the errors of flag values with the flag
+	// name, so the statements that parse them return the errors as they
+	// are. Fields of types that cannot be parsed get no flag, unless their
+	// flag tag asks for one.
+	var flagCode string
+	var flagImports []Import
+	if flagTags.name != "-" {
+		if flagTags.name != "" && len(field.Names) > 1 {
+			return nil, fmt.Errorf("flag names a single field")
+		}
+		if flagCode, flagImports, err = p.parseString(file, param, "return err", scope); err != nil {
+			return nil, err
+		}
+		if flagCode == "" && flagTags.tagged {
+			return nil, fmt.Errorf("flag is not supported for type %s", exprString(param))
+		}
+	}
+	s, ok := p.resolveScalar(file, param)
+	flagBool := ok && s.Kind == kindBool
+
+	var duration string
+	if ok && s.Kind == kindDuration {
+		duration = "value"
+	} else if elemFile, elem, ok := p.sliceElem(file, param); ok {
+		if s, ok := p.resolveScalar(elemFile, elem); ok && s.Kind == kindDuration {
+			duration = "slice"
+		}
+	}
+
+	var fields []Field
+	for _, name := range field.Names {
+		path := via.path + name.Name
+		rules, err := p.parseRules(file, param, wt.parts, toCamelCase(structName)+strings.ReplaceAll(path, ".", ""))
+		if err != nil {
+			return nil, err
+		}
+		fields = append(fields, Field{
+			Name:      name.Name,
+			Path:      path,
+			OptName:   name.Name,
+			Type:      p.render(field.Type),
+			Param:     p.render(param),
+			PtrDepth:  depth,
+			Imports:   fieldImports,
+			Default:   def,
+			Required:  wt.flags["required"],
+			Rules:     rules,
+			Append:    appendMode,
+			ElemType:  elemType,
+			KeyType:   keyType,
+			ValueType: valueType,
+			Clone:     clone,
+			Env:       env,
+			EnvParse:  envCode,
+			Flag:      flagTags.name,
+			FlagUsage: flagTags.usage,
+			FlagParse: flagCode,
+			FlagBool:  flagBool,
+			Duration:  duration,
+
+			envImports:  envImports,
+			flagImports: flagImports,
+			flagTagged:  flagTags.tagged,
+			depth:       via.depth,
+			allocs:      via.allocs,
+			pos:         field.Pos(),
+		})
+	}
+	return fields, nil
+}
+
+// generate renders the options of structs as the file at path, followed by
+// the package-wide declarations helpers selects.
+func (o *outputs) generate(path string, pkg *Package, structs []StructData, helpers helperSet) error {
+	var imports []Import
+	for _, st := range structs {
+		imports = append(imports, st.imports()...)
+	}
+	imports = append(imports, helpers.imports()...)
+	imports, err := mergeImports(imports)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	tmpl := template.Must(template.New("code").Funcs(template.FuncMap{
+		"toStartCase": toStartCase,
+	}).Parse(tmplSrc))
+
+	var buf bytes.Buffer
+	data := struct {
+		Header  string
+		Package string
+		Imports []Import
+		Structs []StructData
+		Helpers helperSet
+	}{
+		Header:  pkg.Config.headerComment(),
+		Package: pkg.Name,
+		Imports: imports,
+		Structs: structs,
+		Helpers: helpers,
+	}
+
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return err
+	}
+
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to format: %w", err)
+	}
+	return o.add(path, formatted)
+}
+
+type Field struct {
+	Name string
+	// Path selects the field from the struct, through the embedded fields
+	// it is promoted from, e.g. "Base.Name". It identifies the field in
+	// errors.
+	Path string
+	// OptName is the name of the field in its option names, e.g. "Name"
+	// in WithName. The with tag may choose another one.
+	OptName string
+	// FuncName is the name of the option function chosen by the name param
+	// of the with tag, used as is.
+	FuncName string
+	// WithFunc, AddFunc and EntryFunc are the names of the option functions
+	// that set the field, append to it and put a map entry.
+	WithFunc  string
+	AddFunc   string
+	EntryFunc string
+	// WithMethod, AddMethod and EntryMethod are the names of the immutable
+	// methods, which are the option function names without the struct
+	// name that a collision prefixes them with.
+	WithMethod  string
+	AddMethod   string
+	EntryMethod string
+	Type        string
+	// Param is the type of the value the option takes, which is the
+	// element type for pointer fields that take values. PtrDepth is the
+	// number of pointers between the field and Param.
+	Param    string
+	PtrDepth int
+	// Imports are the imports of the source file that Type refers to.
+	Imports []Import
+	// Default is the Go expression the constructor initializes the field
+	// with, if any.
+	Default string
+	// Required fields must be set by an option passed to the constructor.
+	Required bool
+	// Rules are checked by the option before it sets the field.
+	Rules []Rule
+	// Append is "slice" or "map" when the field also gets an option that
+	// appends elements or puts a map entry. ElemType, KeyType and ValueType
+	// are the element types of such fields. Rules are checked against the
+	// slice after appending, and against the map after putting the entry.
+	Append    string
+	ElemType  string
+	KeyType   string
+	ValueType string
+	// Env is the environment variable that sets the field, without the
+	// prefix, and EnvParse the statements that parse its value s into v.
+	Env      string
+	EnvParse string
+	// JSONKey and YAMLKey are the keys of the field in config documents,
+	// "-" when it has none.
+	JSONKey string
+	YAMLKey string
+	// Duration is "value" or "slice" when Param is a duration or a slice of
+	// them, which documents spell as strings, as in "5s".
+	Duration string
+	// Flag is the name of the command line flag that sets the field,
+	// without the prefix, and FlagUsage its usage. FlagParse holds the
+	// statements that parse its value s into v, and is empty when the
+	// field has no flag. FlagBool flags need no value.
+	Flag      string
+	FlagUsage string
+	FlagParse string
+	FlagBool  bool
+	// Clone is the package whose Clone function copies the field, "slices"
+	// or "maps", when it is a slice or map.
+	Clone string
+	// Nested is the struct type of a field tagged nested, whose option
+	// takes options of type NestedOption and applies them to the field.
+	// NestedPtr is set for pointers to the struct, which the option
+	// allocates. NestedDefaults is set when the nested struct has defaults.
+	// NestedFieldOption is the type of the options that set a field of the
+	// nested struct, which record the nested fields they set when
+	// NestedHasNested is set.
+	Nested            string
+	NestedOption      string
+	NestedFieldOption string
+	NestedPtr         bool
+	NestedDefaults    bool
+	NestedHasNested   bool
+	// NestedRequired are the fields of the nested struct, and of the
+	// structs nested in it, that must be set by options once the field is.
+	NestedRequired []NestedRequirement
+	// NestedDocument is the document type of the nested struct.
+	NestedDocument string
+
+	envImports  []Import
+	flagImports []Import
+	flagTagged  bool
+	depth       int
+	allocs      []alloc
+	pos         token.Pos
+}
+
+// optionFuncs returns the names of the option functions of the field.
+func (f Field) optionFuncs() []string {
+	switch f.Append {
+	case "slice":
+		return []string{f.WithFunc, f.AddFunc}
+	case "map":
+		return []string{f.WithFunc, f.EntryFunc}
+	}
+	return []string{f.WithFunc}
+}
+
+// Assign returns the statements that store the option's value v in the
+// field of s.
+func (f Field) Assign() string {
+	return f.Alloc("s") + pointerAssign("s."+f.Path, f.PtrDepth)
+}
+
+// Alloc returns the statements that allocate the nil embedded pointers the
+// field of recv is promoted through.
+func (f Field) Alloc(recv string) string {
+	var b strings.Builder
+	for _, a := range f.allocs {
+		fmt.Fprintf(&b, "if %[1]s.%[2]s == nil {\n%[1]s.%[2]s = &%[3]s{}\n}\n", recv, a.Path, a.Type)
+	}
+	return b.String()
+}
+
+type StructData struct {
+	Name string
+	// TypeParams declares the type parameters of a generic struct, e.g.
+	// "[K comparable, V any]", and TypeArgs instantiates it with them, e.g.
+	// "[K, V]". Both are empty for other structs.
+	TypeParams string
+	TypeArgs   string
+	// ParamImports are the imports the type parameter constraints need.
+	ParamImports []Import
+	OptionName   string
+	FuncName     string
+	// FieldOptionName is the type of the options that set a single field.
+	FieldOptionName string
+	OptionType      string
+	Fields          []Field
+	HasCtorFunc     bool
+	HasFieldDup     bool
+	// HasApply is set when the struct already has an Apply method or field,
+	// in which case no Apply method is generated.
+	HasApply bool
+	// Aggregate makes the options apply in full and report all their errors
+	// joined, each wrapped in a FieldError.
+	Aggregate bool
+	// HasValidate is set when the struct has a Validate() error method,
+	// which the constructor calls once the options are applied.
+	HasValidate bool
+	// Flags adds a Register<Struct>Flags function, which registers a flag
+	// for each field that has one.
+	Flags bool
+	// DecodeJSON and DecodeYAML add functions that decode options from
+	// config documents, through the document type DocumentName.
+	DecodeJSON   bool
+	DecodeYAML   bool
+	DocumentName string
+	// SetField is the field of type FieldSetName, declared by the struct to
+	// have the options record the fields they set, if any. The struct gets
+	// an IsSet method then.
+	SetField     string
+	FieldSetName string
+	// Immutable adds methods to the struct value that return a copy with a
+	// field set, like the options.
+	Immutable bool
+	// Builder adds a builder type, BuilderName, which collects options
+	// through methods named after the fields.
+	Builder     bool
+	BuilderName string
+	// HasPostInit and HasPostInitErr are set when the struct has a
+	// PostInit() or PostInit() error method, which the constructor calls
+	// after Validate.
+	HasPostInit    bool
+	HasPostInitErr bool
+}
+
+// RequiredFields returns the paths of the fields that must be set by an
+// option.
+func (s StructData) RequiredFields() []string {
+	var paths []string
+	for _, field := range s.Fields {
+		if field.Required {
+			paths = append(paths, field.Path)
+		}
+	}
+	return paths
+}
+
+// RuleDecls returns the package-level declarations of the struct's rules.
+// declNames returns the names of the package-level declarations the
+// generated code of s declares, but for its option functions and the names
+// its builder, decoding, environment and flag code declare.
+func (s StructData) declNames() []string {
+	names := []string{s.OptionName, s.FuncName, s.FieldOptionName, "apply" + s.Name + "Options"}
+	if !s.HasCtorFunc {
+		names = append(names, s.OptionType)
+	}
+	if s.HasDefaults() {
+		names = append(names, "set"+s.Name+"Defaults")
+	}
+	if s.HasRequired() {
+		names = append(names, "check"+s.Name+"Required")
+	}
+	if s.Immutable && len(s.Clones()) > 0 {
+		names = append(names, "clone"+s.Name)
+	}
+	if s.SetField != "" {
+		names = append(names, s.FieldSetName)
+	}
+	for _, decl := range s.RuleDecls() {
+		name, _, _ := strings.Cut(decl, " ")
+		names = append(names, name)
+	}
+	return names
+}
+
+func (s StructData) RuleDecls() []string {
+	var decls []string
+	for _, field := range s.Fields {
+		for _, rule := range field.Rules {
+			if rule.Decl != "" {
+				decls = append(decls, rule.Decl)
+			}
+		}
+	}
+	return decls
+}
+
+// HasRequired reports whether the constructor checks that options set
+// fields.
+func (s StructData) HasRequired() bool {
+	return len(s.RequiredFields()) > 0 || len(s.NestedRequirements()) > 0
+}
+
+// NestedRequirements returns the required fields of the nested structs.
+func (s StructData) NestedRequirements() []NestedRequirement {
+	var reqs []NestedRequirement
+	for _, field := range s.Fields {
+		reqs = append(reqs, field.NestedRequired...)
+	}
+	return reqs
+}
+
+// HasNested reports whether any field of the struct is nested.
+func (s StructData) HasNested() bool {
+	for _, field := range s.Fields {
+		if field.Nested != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (s StructData) hasRules() bool {
+	for _, field := range s.Fields {
+		if len(field.Rules) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// imports returns every import the generated code of the struct needs.
+func (s StructData) imports() []Import {
+	imports := append([]Import(nil), s.ParamImports...)
+	for _, field := range s.Fields {
+		imports = append(imports, field.Imports...)
+	}
+	if s.HasRequired() {
+		imports = append(imports, Import{Path: "fmt"}, Import{Path: "strings"})
+	}
+	if len(s.RuleDecls()) > 0 {
+		imports = append(imports, Import{Path: "regexp"})
+	}
+	if s.Aggregate {
+		imports = append(imports, Import{Path: "errors"})
+	}
+	if (!s.HasCtorFunc || !s.HasApply) && (s.HasValidate || s.HasPostInitErr) {
+		imports = append(imports, Import{Path: "fmt"})
+	}
+	for _, field := range s.Fields {
+		if field.Append == "map" && len(field.Rules) > 0 {
+			imports = append(imports, Import{Path: "maps"})
+		}
+	}
+	if s.HasEnv() {
+		imports = append(imports, Import{Path: "os"})
+		for _, field := range s.Fields {
+			imports = append(imports, field.envImports...)
+		}
+	}
+	if s.DecodeJSON {
+		imports = append(imports, Import{Path: "encoding/json"}, Import{Path: "io"}, Import{Path: "maps"}, Import{Path: "slices"})
+	}
+	if s.DecodeYAML {
+		imports = append(imports, Import{Path: "gopkg.in/yaml.v3"}, Import{Path: "errors"}, Import{Path: "fmt"}, Import{Path: "io"})
+	}
+	if s.Flags {
+		imports = append(imports, Import{Path: "flag"})
+		for _, field := range s.Fields {
+			if field.FlagParse != "" {
+				imports = append(imports, field.flagImports...)
+			}
+		}
+	}
+	if s.Immutable {
+		for _, field := range s.Fields {
+			if field.Clone != "" {
+				imports = append(imports, Import{Path: field.Clone})
+			}
+		}
+	}
+	return imports
+}
+
+// HasEnv reports whether any field of the struct is set by an environment
+// variable.
+func (s StructData) HasEnv() bool {
+	for _, field := range s.Fields {
+		if field.Env != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// FieldSetWords returns the number of words of the bitset type of the
+// fields.
+func (s StructData) FieldSetWords() int {
+	return max((len(s.Fields)+63)/64, 1)
+}
+
+// Clones returns the fields the immutable methods clone.
+func (s StructData) Clones() []Field {
+	var fields []Field
+	for _, field := range s.Fields {
+		if field.Clone != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// HasDefaults reports whether any field of the struct has a default value.
+func (s StructData) HasDefaults() bool {
+	for _, field := range s.Fields {
+		if field.Default != "" || field.NestedDefaults && !field.NestedPtr {
+			return true
+		}
+	}
+	return false
+}
+
+// typeParamList is the type parameter list of a generic type.
+type typeParamList struct {
+	// Decl is the list as declared, e.g. "[K comparable, V any]".
+	Decl    string
+	Names   []string
+	Imports []Import
+}
+
+// Args returns the list's names as type arguments, e.g. "[K, V]".
+func (l typeParamList) Args() string {
+	if len(l.Names) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(l.Names, ", ") + "]"
+}
+
+// typeParams returns the type parameters of ts, declared in file.
+func (p *Package) typeParams(file *File, ts *ast.TypeSpec) (typeParamList, error) {
+	var l typeParamList
+	if ts.TypeParams == nil {
+		return l, nil
+	}
+	scope := map[string]bool{}
+	for _, field := range ts.TypeParams.List {
+		for _, name := range field.Names {
+			l.Names = append(l.Names, name.Name)
+			scope[name.Name] = true
+		}
+	}
+
+	var decls []string
+	for _, field := range ts.TypeParams.List {
+		var names []string
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+		// Constraints may refer to any of the type parameters.
+		imports, err := p.Imports(file).uses(p, field.Type, scope)
+		if err != nil {
+			return l, fmt.Errorf("%s: %w", p.Fset.Position(field.Type.Pos()), err)
+		}
+		l.Imports = append(l.Imports, imports...)
+		decls = append(decls, strings.Join(names, ", ")+" "+exprString(field.Type))
+	}
+	l.Decl = "[" + strings.Join(decls, ", ") + "]"
+	return l, nil
+}
+
+// hasField reports whether st declares a field called name.
+func hasField(st *ast.StructType, name string) bool {
+	for _, field := range st.Fields.List {
+		for _, ident := range field.Names {
+			if ident.Name == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func exprString(e ast.Expr) string {
+	var buf bytes.Buffer
+	_ = format.Node(&buf, token.NewFileSet(), e)
+	return buf.String()
+}
+
+const tmplSrc = `{{with .Header}}{{.}}
+{{end -}}
+` + generatedComment + `
+
+package {{.Package}}
+
+{{with .Imports}}
+import (
+{{- range .}}
+	{{.}}
+{{- end}}
+)
+{{end}}
+
+{{range .Structs}}
+type {{.OptionName}}{{.TypeParams}} interface {
+	apply(*{{.Name}}{{.TypeArgs}}) error
+}
+
+type {{.FuncName}}{{.TypeParams}} func(*{{.Name}}{{.TypeArgs}}) error
+
+func (f {{.FuncName}}{{.TypeArgs}}) apply(s *{{.Name}}{{.TypeArgs}}) error {
+	return f(s)
+}
+
+// {{.FieldOptionName}} implements {{.OptionName}} for the options that set a
+// named field.
+{{- if .HasNested}}
+// nested holds the paths of the fields of nested structs it sets.
+{{- end}}
+type {{.FieldOptionName}}{{.TypeParams}} struct {
+	field string
+	{{- if .HasNested}}
+	nested []string
+	{{- end}}
+	fn {{.FuncName}}{{.TypeArgs}}
+}
+
+func (o {{.FieldOptionName}}{{.TypeArgs}}) apply(s *{{.Name}}{{.TypeArgs}}) error {
+	{{- if .SetField}}
+	if err := o.fn(s); err != nil {
+		return err
+	}
+	s.{{.SetField}}.add(o.field)
+	return nil
+	{{- else}}
+	return o.fn(s)
+	{{- end}}
+}
+{{- if .SetField}}
+
+// {{.FieldSetName}} records, by their paths, the fields of {{.Name}} that
+// options set.
+type {{.FieldSetName}} [{{.FieldSetWords}}]uint64
+
+// index returns the bit of the field path in the set, or -1 when no option
+// sets it.
+func ({{.FieldSetName}}) index(field string) int {
+	switch field {
+	{{- range $i, $f := .Fields}}
+	case "{{$f.Path}}":
+		return {{$i}}
+	{{- end}}
+	}
+	return -1
+}
+
+func (s *{{.FieldSetName}}) add(field string) {
+	if i := s.index(field); i >= 0 {
+		s[i/64] |= 1 << (i % 64)
+	}
+}
+
+func (s {{.FieldSetName}}) has(field string) bool {
+	i := s.index(field)
+	return i >= 0 && s[i/64]&(1<<(i%64)) != 0
+}
+
+// IsSet reports whether an option set the field of s with the path field,
+// as in "{{(index .Fields 0).Path}}", even to its zero value. Defaults do not
+// count.
+func (s {{.Name}}{{.TypeArgs}}) IsSet(field string) bool {
+	return s.{{.SetField}}.has(field)
+}
+{{- end}}
+
+{{- $optName := .OptionName -}}
+{{- $fieldOptName := .FieldOptionName -}}
+{{- $structName := .Name -}}
+{{- $typeParams := .TypeParams -}}
+{{- $typeArgs := .TypeArgs -}}
+
+{{with .RuleDecls}}
+var (
+{{- range .}}
+	{{.}}
+{{- end}}
+)
+{{end}}
+
+{{range $field := .Fields}}
+{{- if .Nested}}
+
+func {{.WithFunc}}{{$typeParams}}(opts ...{{.NestedOption}}) {{$optName}}{{$typeArgs}} {
+	// The constructor checks the required fields of {{.Nested}} against
+	// the options of every {{.WithFunc}}, which nested records.
+	var nested []string
+	for _, opt := range opts {
+		if o, ok := opt.({{.NestedFieldOption}}); ok {
+			nested = append(nested, "{{.Path}}."+o.field)
+			{{- if .NestedHasNested}}
+			for _, field := range o.nested {
+				nested = append(nested, "{{.Path}}."+field)
+			}
+			{{- end}}
+		}
+	}
+	return {{$fieldOptName}}{{$typeArgs}}{field: "{{.Path}}", nested: nested, fn: func(s *{{$structName}}{{$typeArgs}}) error {
+		{{- .Alloc "s"}}
+		{{- if .NestedPtr}}
+		if s.{{.Path}} == nil {
+			s.{{.Path}} = &{{.Nested}}{}
+			{{- if .NestedDefaults}}
+			set{{.Nested}}Defaults(s.{{.Path}})
+			{{- end}}
+		}
+		if err := apply{{.Nested}}Options(s.{{.Path}}, opts...); err != nil {
+		{{- else}}
+		if err := apply{{.Nested}}Options(&s.{{.Path}}, opts...); err != nil {
+		{{- end}}
+			return nestFieldError("{{$structName}}", "{{.Path}}", err)
+		}
+		return nil
+	}}
+}
+{{- else}}
+
+func {{.WithFunc}}{{$typeParams}}(v {{.Param}}) {{$optName}}{{$typeArgs}} {
+	return {{$fieldOptName}}{{$typeArgs}}{field: "{{.Path}}", fn: func(s *{{$structName}}{{$typeArgs}}) error {
+		{{- range .Rules}}
+		if {{.Check "v"}} {
+			return &RuleError{Struct: "{{$structName}}", Field: "{{$field.Path}}", Rule: {{printf "%q" .Text}}, Value: v}
+		}
+		{{- end}}
+		{{.Assign}}
+		return nil
+	}}
+}
+
+{{- if eq .Append "slice"}}
+
+func {{.AddFunc}}{{$typeParams}}(v ...{{.ElemType}}) {{$optName}}{{$typeArgs}} {
+	return {{$fieldOptName}}{{$typeArgs}}{field: "{{.Path}}", fn: func(s *{{$structName}}{{$typeArgs}}) error {
+		{{- .Alloc "s"}}
+		// Never append into the spare capacity of a slice passed to an option.
+		next := append(s.{{.Path}}[:len(s.{{.Path}}):len(s.{{.Path}})], v...)
+		{{- range .Rules}}
+		if {{.Check "next"}} {
+			return &RuleError{Struct: "{{$structName}}", Field: "{{$field.Path}}", Rule: {{printf "%q" .Text}}, Value: next}
+		}
+		{{- end}}
+		s.{{.Path}} = next
+		return nil
+	}}
+}
+{{- else if eq .Append "map"}}
+
+func {{.EntryFunc}}{{$typeParams}}(k {{.KeyType}}, v {{.ValueType}}) {{$optName}}{{$typeArgs}} {
+	return {{$fieldOptName}}{{$typeArgs}}{field: "{{.Path}}", fn: func(s *{{$structName}}{{$typeArgs}}) error {
+		{{- .Alloc "s"}}
+		{{- if .Rules}}
+		// Put the entry into a copy, so that the map stays as it was when
+		// the entry breaks a rule.
+		next := maps.Clone(s.{{.Path}})
+		if next == nil {
+			next = make({{.Type}})
+		}
+		next[k] = v
+		{{- range .Rules}}
+		if {{.Check "next"}} {
+			return &RuleError{Struct: "{{$structName}}", Field: "{{$field.Path}}", Rule: {{printf "%q" .Text}}, Value: next}
+		}
+		{{- end}}
+		s.{{.Path}} = next
+		{{- else}}
+		if s.{{.Path}} == nil {
+			s.{{.Path}} = make({{.Type}})
+		}
+		s.{{.Path}}[k] = v
+		{{- end}}
+		return nil
+	}}
+}
+{{- end}}
+{{- end}}
+{{end}}
+
+{{if .HasDefaults}}
+func set{{.Name}}Defaults{{.TypeParams}}(obj *{{.Name}}{{.TypeArgs}}) {
+{{- range .Fields}}{{if .Default}}
+	{{.Alloc "obj"}}obj.{{.Path}} = {{.Default}}
+{{- else if and .NestedDefaults (not .NestedPtr)}}
+	{{.Alloc "obj"}}set{{.Nested}}Defaults(&obj.{{.Path}})
+{{- end}}{{end}}
+}
+{{end}}
+
+{{if .HasRequired}}
+// check{{$structName}}Required returns an error naming every required field
+// that none of opts sets. Fields set to their zero value count as set. Once
+// an option sets a nested field, the options passed to it must set the
+// required fields of the nested struct.
+func check{{$structName}}Required{{$typeParams}}(opts []{{$optName}}{{$typeArgs}}) error {
+	set := map[string]bool{}
+	for _, opt := range opts {
+		if o, ok := opt.({{$fieldOptName}}{{$typeArgs}}); ok {
+			set[o.field] = true
+			{{- if .HasNested}}
+			for _, field := range o.nested {
+				set[field] = true
+			}
+			{{- end}}
+		}
+	}
+	var missing []string
+	{{- with .RequiredFields}}
+	for _, field := range []string{ {{- range $i, $name := .}}{{if $i}}, {{end}}"{{$name}}"{{end -}} } {
+		if !set[field] {
+			missing = append(missing, field)
+		}
+	}
+	{{- end}}
+	{{- range .NestedRequirements}}
+	if set["{{.If}}"] && !set["{{.Path}}"] {
+		missing = append(missing, "{{.Path}}")
+	}
+	{{- end}}
+	if len(missing) > 0 {
+		return fmt.Errorf("{{$structName}}: missing required options for %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+{{end}}
+
+{{if .Aggregate}}
+// apply{{.Name}}Options applies all opts to obj in order and joins their
+// errors. It is shared by the generated and hand-written constructors.
+func apply{{.Name}}Options{{.TypeParams}}(obj *{{.Name}}{{.TypeArgs}}, opts ...{{.OptionName}}{{.TypeArgs}}) error {
+	var errs []error
+	for _, opt := range opts {
+		if err := opt.apply(obj); err != nil {
+			if o, ok := opt.({{.FieldOptionName}}{{.TypeArgs}}); ok {
+				err = &FieldError{Field: o.field, Err: err}
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+{{else}}
+// apply{{.Name}}Options applies opts to obj in order and stops at the first
+// error. It is shared by the generated and hand-written constructors.
+func apply{{.Name}}Options{{.TypeParams}}(obj *{{.Name}}{{.TypeArgs}}, opts ...{{.OptionName}}{{.TypeArgs}}) error {
+	for _, opt := range opts {
+		if err := opt.apply(obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+{{end}}
+
+{{if not .HasApply}}
+// Apply reconfigures s with opts. s may be partially updated when an option
+// fails.
+func (s *{{.Name}}{{.TypeArgs}}) Apply(opts ...{{.OptionName}}{{.TypeArgs}}) error {
+	if err := apply{{.Name}}Options(s, opts...); err != nil {
+		return err
+	}
+	{{- if .HasValidate}}
+	if err := s.Validate(); err != nil {
+		return fmt.Errorf("invalid {{.Name}}: %w", err)
+	}
+	{{- end}}
+	{{- if .HasPostInitErr}}
+	if err := s.PostInit(); err != nil {
+		return fmt.Errorf("{{.Name}} post init: %w", err)
+	}
+	{{- else if .HasPostInit}}
+	s.PostInit()
+	{{- end}}
+	return nil
+}
+{{end}}
+
+{{- if .Immutable}}
+{{- $recv := print .Name .TypeArgs}}
+{{- $setField := .SetField}}
+{{- $clone := ""}}
+{{- with .Clones}}
+{{- $clone = print "s = clone" $structName "(s)"}}
+
+// clone{{$structName}} returns a copy of s that shares no slice or map with
+// s.
+func clone{{$structName}}{{$typeParams}}(s {{$recv}}) {{$recv}} {
+	{{- range .}}
+	s.{{.Path}} = {{.Clone}}.Clone(s.{{.Path}})
+	{{- end}}
+	return s
+}
+{{- end}}
+{{- range .Fields}}
+
+// {{.WithMethod}} returns a copy of s with {{.Path}} set to v. It checks no
+// rules, unlike the {{.WithFunc}} option.
+{{- if .Nested}}
+func (s {{$recv}}) {{.WithMethod}}(v {{.Type}}) {{$recv}} {
+	{{- with $clone}}
+	{{.}}
+	{{- end}}
+	s.{{.Path}} = v
+	{{- if $setField}}
+	s.{{$setField}}.add("{{.Path}}")
+	{{- end}}
+	return s
+}
+{{- else}}
+func (s {{$recv}}) {{.WithMethod}}(v {{.Param}}) {{$recv}} {
+	{{- with $clone}}
+	{{.}}
+	{{- end}}
+	{{.Assign}}
+	{{- if $setField}}
+	s.{{$setField}}.add("{{.Path}}")
+	{{- end}}
+	return s
+}
+{{- end}}
+{{- if eq .Append "slice"}}
+
+// {{.AddMethod}} returns a copy of s with v appended to {{.Path}}.
+func (s {{$recv}}) {{.AddMethod}}(v ...{{.ElemType}}) {{$recv}} {
+	{{- with $clone}}
+	{{.}}
+	{{- end}}
+	s.{{.Path}} = append(s.{{.Path}}, v...)
+	{{- if $setField}}
+	s.{{$setField}}.add("{{.Path}}")
+	{{- end}}
+	return s
+}
+{{- else if eq .Append "map"}}
+
+// {{.EntryMethod}} returns a copy of s with the entry k of {{.Path}} set
+// to v.
+func (s {{$recv}}) {{.EntryMethod}}(k {{.KeyType}}, v {{.ValueType}}) {{$recv}} {
+	{{- with $clone}}
+	{{.}}
+	{{- end}}
+	if s.{{.Path}} == nil {
+		s.{{.Path}} = make({{.Type}})
+	}
+	s.{{.Path}}[k] = v
+	{{- if $setField}}
+	s.{{$setField}}.add("{{.Path}}")
+	{{- end}}
+	return s
+}
+{{- end}}
+{{- end}}
+{{end}}
+
+{{- if .HasEnv}}
+{{template "env" .}}
+{{end}}
+
+{{- if .Flags}}
+{{template "flags" .}}
+{{end}}
+
+{{- if or .DecodeJSON .DecodeYAML}}
+{{template "decode" .}}
+{{end}}
+
+{{if not .HasCtorFunc}}
+func {{.OptionType}}{{.TypeParams}}(opts ...{{.OptionName}}{{.TypeArgs}}) (*{{.Name}}{{.TypeArgs}}, error) {
+	{{- if and .HasRequired (not .Aggregate)}}
+	if err := check{{.Name}}Required(opts); err != nil {
+		return nil, err
+	}
+	{{- end}}
+	obj := &{{.Name}}{{.TypeArgs}}{}
+	{{- if .HasDefaults}}
+	set{{.Name}}Defaults(obj)
+	{{- end}}
+	{{- if and .HasRequired .Aggregate}}
+	if err := errors.Join(check{{.Name}}Required(opts), apply{{.Name}}Options(obj, opts...)); err != nil {
+		return nil, err
+	}
+	{{- else}}
+	if err := apply{{.Name}}Options(obj, opts...); err != nil {
+		return nil, err
+	}
+	{{- end}}
+	{{- if .HasValidate}}
+	if err := obj.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid {{.Name}}: %w", err)
+	}
+	{{- end}}
+	{{- if .HasPostInitErr}}
+	if err := obj.PostInit(); err != nil {
+		return nil, fmt.Errorf("{{.Name}} post init: %w", err)
+	}
+	{{- else if .HasPostInit}}
+	obj.PostInit()
+	{{- end}}
+	return obj, nil
+}
+{{end}}
+
+{{- if .Builder}}
+
+// {{.BuilderName}} collects {{.Name}} options for Build.
+type {{.BuilderName}}{{.TypeParams}} struct {
+	opts []{{.OptionName}}{{.TypeArgs}}
+}
+
+// New{{.BuilderName}} returns an empty {{.BuilderName}}.
+func New{{.BuilderName}}{{.TypeParams}}() *{{.BuilderName}}{{.TypeArgs}} {
+	return &{{.BuilderName}}{{.TypeArgs}}{}
+}
+{{- $builder := print .BuilderName .TypeArgs}}
+{{- range .Fields}}
+{{- if .Nested}}
+
+func (b *{{$builder}}) {{toStartCase .OptName}}(opts ...{{.NestedOption}}) *{{$builder}} {
+	b.opts = append(b.opts, {{.WithFunc}}{{$typeArgs}}(opts...))
+	return b
+}
+{{- else}}
+
+func (b *{{$builder}}) {{toStartCase .OptName}}(v {{.Param}}) *{{$builder}} {
+	b.opts = append(b.opts, {{.WithFunc}}{{$typeArgs}}(v))
+	return b
+}
+{{- end}}
+{{- if eq .Append "slice"}}
+
+func (b *{{$builder}}) Add{{toStartCase .OptName}}(v ...{{.ElemType}}) *{{$builder}} {
+	b.opts = append(b.opts, {{.AddFunc}}{{$typeArgs}}(v...))
+	return b
+}
+{{- else if eq .Append "map"}}
+
+func (b *{{$builder}}) {{toStartCase .OptName}}Entry(k {{.KeyType}}, v {{.ValueType}}) *{{$builder}} {
+	b.opts = append(b.opts, {{.EntryFunc}}{{$typeArgs}}(k, v))
+	return b
+}
+{{- end}}
+{{- end}}
+
+// Build returns a new {{.Name}} from the options collected by b, made by
+// {{.OptionType}}.
+func (b *{{$builder}}) Build() (*{{.Name}}{{.TypeArgs}}, error) {
+	return {{.OptionType}}{{.TypeArgs}}(b.opts...)
+}
+{{- end}}
+
+{{end}}
+
+{{- define "env"}}
+{{- $typeArgs := .TypeArgs}}
+
+// {{.Name}}OptionsFromEnv returns the options set by the environment
+// variables the env tags of {{.Name}} name, each prefixed with prefix, as
+// in "APP_". Slices are read from comma-separated lists.
+func {{.Name}}OptionsFromEnv{{.TypeParams}}(prefix string) ([]{{.OptionName}}{{.TypeArgs}}, error) {
+	var opts []{{.OptionName}}{{.TypeArgs}}
+	{{- range .Fields}}
+	{{- if .Env}}
+	if s, ok := os.LookupEnv(prefix + "{{.Env}}"); ok {
+		{{.EnvParse}}
+		opts = append(opts, {{.WithFunc}}{{$typeArgs}}(v))
+	}
+	{{- end}}
+	{{- end}}
+	return opts, nil
+}
+{{- end}}
+
+{{- define "flags"}}
+{{- $typeArgs := .TypeArgs}}
+
+// Register{{.Name}}Flags registers a flag on fs for each option of {{.Name}}
+// that has one, named with prefix, as in "db.". The function it returns
+// returns the options of the flags set, once fs is parsed. Slices are read
+// from comma-separated lists.
+func Register{{.Name}}Flags{{.TypeParams}}(fs *flag.FlagSet, prefix string) func() []{{.OptionName}}{{.TypeArgs}} {
+	var opts []{{.OptionName}}{{.TypeArgs}}
+	{{- range .Fields}}
+	{{- if .FlagParse}}
+	fs.{{if .FlagBool}}BoolFunc{{else}}Func{{end}}(prefix+"{{.Flag}}", {{printf "%q" .FlagUsage}}, func(s string) error {
+		{{.FlagParse}}
+		opts = append(opts, {{.WithFunc}}{{$typeArgs}}(v))
+		return nil
+	})
+	{{- end}}
+	{{- end}}
+	return func() []{{.OptionName}}{{.TypeArgs}} {
+		return opts
+	}
+}
+{{- end}}
+
+{{- define "decode"}}
+{{- $typeArgs := .TypeArgs}}
+{{- $doc := print .DocumentName .TypeArgs}}
+
+// {{.DocumentName}} holds the keys present in a config document of
+// {{.Name}}, each decoded into the value of its option.
+type {{.DocumentName}}{{.TypeParams}} struct {
+	{{- range .Fields}}
+	{{- if .Nested}}
+	{{toStartCase .OptName}} *{{.NestedDocument}}
+	{{- else}}
+	{{toStartCase .OptName}} *{{.Param}}
+	{{- end}}
+	{{- end}}
+}
+
+// options returns an option for each key present in d.
+func (d *{{$doc}}) options() []{{.OptionName}}{{.TypeArgs}} {
+	var opts []{{.OptionName}}{{.TypeArgs}}
+	{{- range .Fields}}
+	if d.{{toStartCase .OptName}} != nil {
+		{{- if .Nested}}
+		opts = append(opts, {{.WithFunc}}{{$typeArgs}}(d.{{toStartCase .OptName}}.options()...))
+		{{- else}}
+		opts = append(opts, {{.WithFunc}}{{$typeArgs}}(*d.{{toStartCase .OptName}}))
+		{{- end}}
+	}
+	{{- end}}
+	return opts
+}
+{{- if .DecodeJSON}}
+
+// UnmarshalJSON decodes the keys of the JSON object data. Unknown keys are
+// errors.
+func (d *{{$doc}}) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	for _, key := range slices.Sorted(maps.Keys(raw)) {
+		var err error
+		switch key {
+		{{- range .Fields}}
+		{{- if ne .JSONKey "-"}}
+		case {{printf "%q" .JSONKey}}:
+			{{- if eq .Duration "value"}}
+			d.{{toStartCase .OptName}}, err = decodeJSONDuration[{{.Param}}](raw[key])
+			{{- else if eq .Duration "slice"}}
+			d.{{toStartCase .OptName}}, err = decodeJSONDurations[{{.Param}}](raw[key])
+			{{- else}}
+			err = json.Unmarshal(raw[key], &d.{{toStartCase .OptName}})
+			{{- end}}
+		{{- end}}
+		{{- end}}
+		default:
+			err = ErrUnknownKey
+		}
+		if err != nil {
+			return nestKeyError(key, err)
+		}
+	}
+	return nil
+}
+
+// {{.Name}}OptionsFromJSON returns an option for each key of the JSON
+// object r holds, so that the options check and set the values as usual.
+// Unknown keys are errors, reported in a KeyError.
+func {{.Name}}OptionsFromJSON{{.TypeParams}}(r io.Reader) ([]{{.OptionName}}{{.TypeArgs}}, error) {
+	var d {{$doc}}
+	if err := json.NewDecoder(r).Decode(&d); err != nil {
+		return nil, err
+	}
+	return d.options(), nil
+}
+{{- end}}
+{{- if .DecodeYAML}}
+
+// UnmarshalYAML decodes the keys of the YAML mapping value. Unknown keys are
+// errors.
+func (d *{{$doc}}) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: {{.Name}} needs a mapping", value.Line)
+	}
+	for i := 0; i+1 < len(value.Content); i += 2 {
+		key := value.Content[i].Value
+		var err error
+		switch key {
+		{{- range .Fields}}
+		{{- if ne .YAMLKey "-"}}
+		case {{printf "%q" .YAMLKey}}:
+			{{- if eq .Duration "value"}}
+			d.{{toStartCase .OptName}}, err = decodeYAMLDuration[{{.Param}}](value.Content[i+1])
+			{{- else if eq .Duration "slice"}}
+			d.{{toStartCase .OptName}}, err = decodeYAMLDurations[{{.Param}}](value.Content[i+1])
+			{{- else}}
+			err = value.Content[i+1].Decode(&d.{{toStartCase .OptName}})
+			{{- end}}
+		{{- end}}
+		{{- end}}
+		default:
+			err = ErrUnknownKey
+		}
+		if err != nil {
+			return nestKeyError(key, err)
+		}
+	}
+	return nil
+}
+
+// {{.Name}}OptionsFromYAML returns an option for each key of the YAML
+// mapping r holds, so that the options check and set the values as usual.
+// Unknown keys are errors, reported in a KeyError.
+func {{.Name}}OptionsFromYAML{{.TypeParams}}(r io.Reader) ([]{{.OptionName}}{{.TypeArgs}}, error) {
+	var d {{$doc}}
+	if err := yaml.NewDecoder(r).Decode(&d); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return d.options(), nil
+}
+{{- end}}
+{{- end}}
+
+
+{{- if .Helpers.Rules}}
+
+// RuleError reports an option value that violates a rule of its field's with
+// tag.
+type RuleError struct {
+	// Struct and Field name the field the option sets.
+	Struct string
+	Field  string
+	// Rule is the violated rule as written in the tag, e.g. "min=1".
+	Rule  string
+	Value any
+}
+
+func (e *RuleError) Error() string {
+	value := fmt.Sprintf("%#v", e.Value)
+	if s, ok := e.Value.(fmt.Stringer); ok {
+		value = s.String()
+	}
+	return fmt.Sprintf("%s.%s: value %s violates rule %s", e.Struct, e.Field, value, e.Rule)
+}
+{{- end}}
+
+{{- if .Helpers.Fields}}
+
+// FieldError wraps the error of an option with the name of the field it
+// sets.
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	if namesField(e.Err, e.Field) {
+		return e.Err.Error()
+	}
+	return e.Field + ": " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// namesField reports whether err names field, or fields nested in it,
+// already. Rule errors and the errors of nested options do.
+func namesField(err error, field string) bool {
+	switch err := err.(type) {
+	case *FieldError:
+		return err.Field == field || strings.HasPrefix(err.Field, field+".")
+	case interface{ Unwrap() []error }:
+		for _, err := range err.Unwrap() {
+			if !namesField(err, field) {
+				return false
+			}
+		}
+		return true
+	}
+	{{- if .Helpers.Rules}}
+	var re *RuleError
+	return errors.As(err, &re) && (re.Field == field || strings.HasPrefix(re.Field, field+"."))
+	{{- else}}
+	return false
+	{{- end}}
+}
+
+// nestFieldError prefixes the fields named by err, the error of the options
+// of a struct nested in the field path of structName, with path.
+func nestFieldError(structName, path string, err error) error {
+	switch err := err.(type) {
+	{{- if .Helpers.Rules}}
+	case *RuleError:
+		return &RuleError{Struct: structName, Field: path + "." + err.Field, Rule: err.Rule, Value: err.Value}
+	{{- end}}
+	case *FieldError:
+		inner := err.Err
+		if namesField(inner, err.Field) {
+			inner = nestFieldError(structName, path, inner)
+		}
+		return &FieldError{Field: path + "." + err.Field, Err: inner}
+	case interface{ Unwrap() []error }:
+		var errs []error
+		for _, err := range err.Unwrap() {
+			errs = append(errs, nestFieldError(structName, path, err))
+		}
+		return errors.Join(errs...)
+	}
+	return &FieldError{Field: path, Err: err}
+}
+{{- end}}
+
+{{- if .Helpers.Keys}}
+
+// ErrUnknownKey is the error of a config document key that names no option.
+var ErrUnknownKey = errors.New("unknown key")
+
+// KeyError reports a config document key whose value cannot be decoded.
+type KeyError struct {
+	// Key is the path of the key, as in "db.port".
+	Key string
+	Err error
+}
+
+func (e *KeyError) Error() string {
+	return "key " + e.Key + ": " + e.Err.Error()
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// nestKeyError prefixes the path of the key err reports, the error of the
+// value of key, with key.
+func nestKeyError(key string, err error) error {
+	if err, ok := err.(*KeyError); ok {
+		return &KeyError{Key: key + "." + err.Key, Err: err.Err}
+	}
+	return &KeyError{Key: key, Err: err}
+}
+{{- end}}
+
+{{- if .Helpers.JSONDurations}}
+
+// decodeJSONDuration decodes the JSON string data, as in "5s", into a
+// duration. Null decodes into nil.
+func decodeJSONDuration[D ~int64](data []byte) (*D, error) {
+	var s *string
+	if err := json.Unmarshal(data, &s); err != nil || s == nil {
+		return nil, err
+	}
+	v, err := time.ParseDuration(*s)
+	if err != nil {
+		return nil, err
+	}
+	d := D(v)
+	return &d, nil
+}
+
+// decodeJSONDurations decodes the JSON array of strings data into
+// durations. Null decodes into nil.
+func decodeJSONDurations[S ~[]D, D ~int64](data []byte) (*S, error) {
+	var list *[]string
+	if err := json.Unmarshal(data, &list); err != nil || list == nil {
+		return nil, err
+	}
+	s := make(S, len(*list))
+	for i, item := range *list {
+		v, err := time.ParseDuration(item)
+		if err != nil {
+			return nil, err
+		}
+		s[i] = D(v)
+	}
+	return &s, nil
+}
+{{- end}}
+
+{{- if .Helpers.YAMLDurations}}
+
+// decodeYAMLDuration decodes the YAML string node, as in "5s", into a
+// duration. Null decodes into nil.
+func decodeYAMLDuration[D ~int64](node *yaml.Node) (*D, error) {
+	var s *string
+	if err := node.Decode(&s); err != nil || s == nil {
+		return nil, err
+	}
+	v, err := time.ParseDuration(*s)
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %w", node.Line, err)
+	}
+	d := D(v)
+	return &d, nil
+}
+
+// decodeYAMLDurations decodes the YAML sequence of strings node into
+// durations. Null decodes into nil.
+func decodeYAMLDurations[S ~[]D, D ~int64](node *yaml.Node) (*S, error) {
+	var list *[]string
+	if err := node.Decode(&list); err != nil || list == nil {
+		return nil, err
+	}
+	s := make(S, len(*list))
+	for i, item := range *list {
+		v, err := time.ParseDuration(item)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", node.Content[i].Line, err)
+		}
+		s[i] = D(v)
+	}
+	return &s, nil
+}
+{{end}}`
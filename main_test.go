@@ -0,0 +1,351 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestFiles writes files, by slash-separated path, into a new temporary
+// directory and returns the directory.
+func writeTestFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// loadTestPackage loads a package of the file a.go holding src.
+func loadTestPackage(t *testing.T, src string) *Package {
+	t.Helper()
+	pkg, err := loadPackage(writeTestFiles(t, map[string]string{"a.go": src}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkg
+}
+
+// generateTestPackage generates the options of the package in dir and
+// writes them next to its files.
+func generateTestPackage(t *testing.T, dir string) error {
+	t.Helper()
+	pkg, err := loadPackage(dir)
+	if err != nil {
+		return err
+	}
+	if err := configure(pkg); err != nil {
+		return err
+	}
+	t.Cleanup(func() { resetInitialisms() })
+	var out outputs
+	if err := generatePackage(pkg, &out); err != nil {
+		return err
+	}
+	return out.write()
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name: "should pass; derived names prefixed with the struct",
+			files: map[string]string{
+				"a.go": "package p\n\ntype A struct {\n\tName string `with:\"-\"`\n}\n\ntype B struct {\n\tName string `with:\"-\"`\n}\n",
+			},
+		},
+		{
+			name: "should fail; tag name of a field taken by another field",
+			files: map[string]string{
+				"a.go": "package p\n\ntype A struct {\n\tFoo  string `with:\"Name\"`\n\tName string `with:\"-\"`\n}\n",
+			},
+			wantErr: "a.go:5:2: option WithName of A.Name is taken by A.Foo",
+		},
+		{
+			name: "should fail; tag name of a field taken by a promoted field",
+			files: map[string]string{
+				"go.mod":       "module t\n\ngo 1.23\n",
+				"base/base.go": "package base\n\ntype Base struct {\n\tLevel string `with:\"-\"`\n}\n",
+				"a.go":         "package p\n\nimport \"t/base\"\n\ntype Other struct {\n\tLevel string `with:\"-\"`\n}\n\ntype Outer struct {\n\tbase.Base\n\tLvl string `with:\"Level\"`\n}\n",
+			},
+			wantErr: "a.go:9:6: option Outer_WithLevel of Outer.Base.Level is taken by Outer.Lvl",
+		},
+		{
+			name: "should fail; function name of a field taken by a field of another struct",
+			files: map[string]string{
+				"a.go": "package p\n\ntype A struct {\n\tFoo int `with:\"name=WithBar\"`\n}\n\ntype B struct {\n\tBar int `with:\"-\"`\n}\n",
+			},
+			wantErr: "a.go:8:2: option WithBar of B.Bar is taken by A.Foo",
+		},
+		{
+			name: "should fail; append option taken by another field",
+			files: map[string]string{
+				"a.go": "package p\n\ntype A struct {\n\tTags    []string `with:\"-,append\"`\n\tAddTags int      `with:\"name=AddTags\"`\n}\n",
+			},
+			wantErr: "a.go:5:2: option AddTags of A.AddTags is taken by A.Tags",
+		},
+		{
+			name: "should pass; variable prefixes the option name",
+			files: map[string]string{
+				"a.go": "package p\n\nvar WithName = 1\n\ntype A struct {\n\tName string `with:\"-\"`\n}\n",
+			},
+		},
+		{
+			name: "should fail; option name taken by a variable",
+			files: map[string]string{
+				".genopts.yaml": "collisions: error\n",
+				"a.go":          "package p\n\nvar WithName = 1\n\ntype A struct {\n\tName string `with:\"-\"`\n}\n",
+			},
+			wantErr: "a.go:6:2: option WithName of A is declared by the package already",
+		},
+		{
+			name: "should fail; helper taken by a variable",
+			files: map[string]string{
+				"a.go": "package p\n\nimport \"errors\"\n\nvar ErrUnknownKey = errors.New(\"unknown\")\n\n//genopts:decode\ntype A struct {\n\tName string `with:\"-\"`\n}\n",
+			},
+			wantErr: "a.go:5:5: ErrUnknownKey is declared by the package already",
+		},
+		{
+			name: "should fail; constructor taken by a constant",
+			files: map[string]string{
+				"a.go": "package p\n\nconst NewA = 1\n\ntype A struct {\n\tName string `with:\"-\"`\n}\n",
+			},
+			wantErr: "a.go:5:6: NewA is declared by the package already",
+		},
+		{
+			name: "should fail; option type taken by a variable",
+			files: map[string]string{
+				"a.go": "package p\n\nvar AOption any\n\ntype A struct {\n\tName string `with:\"-\"`\n}\n",
+			},
+			wantErr: "a.go:5:6: AOption is declared by the package already",
+		},
+		{
+			name: "should fail; undeclared field type",
+			files: map[string]string{
+				"a.go": "package p\n\ntype A struct {\n\tK Kind `with:\"-\"`\n}\n",
+			},
+			wantErr: "a.go:4:2: undeclared type Kind",
+		},
+		{
+			name: "should fail; undeclared constraint",
+			files: map[string]string{
+				"a.go": "package p\n\ntype A[T Missing] struct {\n\tV T `with:\"-\"`\n}\n",
+			},
+			wantErr: "a.go:3:10: undeclared type Missing",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := generateTestPackage(t, writeTestFiles(t, tt.files))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("generate error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("generate error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerateFileHelpers(t *testing.T) {
+	const (
+		ruleSrc  = "package p\n\ntype A struct {\n\tPort int `with:\"-,min=1\"`\n}\n"
+		plainSrc = "package p\n\ntype A struct {\n\tPort int `with:\"-\"`\n}\n"
+		otherSrc = "package p\n\ntype B struct {\n\tName string `with:\"-\"`\n}\n"
+	)
+	tests := []struct {
+		name        string
+		src         string
+		file        string
+		wantHelpers bool
+		wantStale   []string
+	}{
+		{name: "should pass; helpers of the file", src: ruleSrc, file: "a.go", wantHelpers: true},
+		{name: "should pass; helpers of another file", src: ruleSrc, file: "b.go", wantHelpers: true},
+		{name: "should pass; stale helpers", src: plainSrc, file: "b.go", wantStale: []string{"genopts.gen.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeTestFiles(t, map[string]string{
+				"a.go":           tt.src,
+				"b.go":           otherSrc,
+				"genopts.gen.go": generatedComment + "\n\npackage p\n",
+			})
+			t.Cleanup(func() { resetInitialisms() })
+			var out outputs
+			if err := generateFile(filepath.Join(dir, tt.file), &out); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.has(filepath.Join(dir, "genopts.gen.go")); got != tt.wantHelpers {
+				t.Errorf("generateFile() generated helpers = %v, want %v", got, tt.wantHelpers)
+			}
+			var gotStale []string
+			for _, path := range out.stale {
+				gotStale = append(gotStale, filepath.Base(path))
+			}
+			if strings.Join(gotStale, " ") != strings.Join(tt.wantStale, " ") {
+				t.Errorf("generateFile() stale = %q, want %q", gotStale, tt.wantStale)
+			}
+		})
+	}
+}
+
+// vetPackages are packages of a module that exercise the features of the
+// generator together.
+var vetPackages = map[string]string{
+	"nested/nested.go": `package nested
+
+import "time"
+
+type DB struct {
+	Host string ` + "`with:\"-,required\"`" + `
+	Port int    ` + "`with:\"-,default=5432,min=1,max=65535\"`" + `
+}
+
+//genopts:aggregate
+type Server struct {
+	Addr    string        ` + "`with:\"-,regex='^[a-z]{1,8}:[0-9]+$'\"`" + `
+	Timeout time.Duration ` + "`with:\"-,default=30s,min=1s\"`" + `
+	Tags    []string      ` + "`with:\"-,append,len<=4\" default:\"a,b\"`" + `
+	DB      *DB           ` + "`with:\"-,nested\"`" + `
+}
+`,
+	"decode/decode.go": `package decode
+
+import "time"
+
+//genopts:decode=json,yaml
+type Config struct {
+	Name   string          ` + "`json:\"name\" yaml:\"name\" with:\"-,nonempty\"`" + `
+	Wait   Wait            ` + "`json:\"wait\" yaml:\"wait\" with:\"-\"`" + `
+	Waits  []time.Duration ` + "`json:\"waits\" yaml:\"waits\" with:\"-\"`" + `
+	Labels map[string]int  ` + "`json:\"labels\" yaml:\"labels\" with:\"-,append\"`" + `
+}
+
+type Wait time.Duration
+`,
+	"cli/cli.go": `package cli
+
+import "time"
+
+//genopts:flags
+type Worker struct {
+	Queue    string        ` + "`with:\"-,required,name=ForQueue\" env:\"QUEUE\"`" + `
+	Workers  int           ` + "`with:\"-,default=4,min=1\" env:\"WORKERS\" flag:\",number of workers\"`" + `
+	Interval time.Duration ` + "`with:\"-,default=1s\" env:\"INTERVAL\"`" + `
+	Verbose  bool          ` + "`with:\"-\" flag:\"v,verbose output\"`" + `
+}
+`,
+	"build/build.go": `package build
+
+//genopts:builder
+type Request[K comparable, V any] struct {
+	Method string  ` + "`with:\"-,default=GET,oneof=GET|POST\"`" + `
+	Params map[K]V ` + "`with:\"-,append\"`" + `
+}
+
+//genopts:immutable
+type Logger struct {
+	Level  string   ` + "`with:\"-,default=info,oneof=debug|info\"`" + `
+	Fields []string ` + "`with:\"-\"`" + `
+
+	set loggerFieldSet
+}
+`,
+	"dot/dot.go": `package dot
+
+import . "net/url"
+
+type Client struct {
+	Base    *URL   ` + "`with:\"-,required\"`" + `
+	Query   Values ` + "`with:\"-\"`" + `
+	Retries int    ` + "`with:\"-,default=3\"`" + `
+}
+`,
+	"dot/other.gen.go": "// Code generated by other. DO NOT EDIT.\n\npackage dot\n\nconst WithRetries = 0\n",
+}
+
+func TestGenerateVet(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs the go command")
+	}
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go command")
+	}
+	sum, err := os.ReadFile("go.sum")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"go.mod": "module vet\n\ngo 1.23\n\nrequire gopkg.in/yaml.v3 v3.0.1\n",
+		"go.sum": string(sum),
+	}
+	var dirs []string
+	for name, src := range vetPackages {
+		files[name] = src
+		dirs = append(dirs, path.Dir(name))
+	}
+	dir := writeTestFiles(t, files)
+	for _, pkgDir := range dirs {
+		if err := generateTestPackage(t, filepath.Join(dir, pkgDir)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cmd := exec.Command(goCmd, "vet", "./...")
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go vet: %v\n%s", err, output)
+	}
+}
+
+func TestExamplesUpToDate(t *testing.T) {
+	dirs, err := expandPattern("./examples/...")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out outputs
+	for _, dir := range dirs {
+		pkg, err := loadPackage(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pkg == nil {
+			continue
+		}
+		if err := configure(pkg); err != nil {
+			t.Fatal(err)
+		}
+		if err := generatePackage(pkg, &out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { resetInitialisms() })
+
+	var diff strings.Builder
+	upToDate, err := out.check(&diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !upToDate {
+		t.Errorf("examples are out of date; run go run . -pkg ./examples/...\n%s", diff.String())
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// commonInitialisms are the initialisms golint spells in all caps in Go
+// identifiers.
+var commonInitialisms = []string{
+	"ACL", "API", "ASCII", "CPU", "CSS", "DNS", "EOF", "GUID", "HTML", "HTTP",
+	"HTTPS", "ID", "IP", "JSON", "LHS", "QPS", "RAM", "RHS", "RPC", "SLA",
+	"SMTP", "SQL", "SSH", "TCP", "TLS", "TTL", "UDP", "UI", "UID", "UUID",
+	"URI", "URL", "UTF8", "VM", "XML", "XMPP", "XSRF", "XSS",
+}
+
+// initialisms holds the initialisms option names spell in all caps, keyed
+// in upper case.
+var initialisms = map[string]bool{}
+
+func init() {
+	resetInitialisms()
+}
+
+// resetInitialisms makes option names spell the common initialisms and
+// extra in all caps.
+func resetInitialisms(extra ...string) {
+	initialisms = map[string]bool{}
+	addInitialisms(commonInitialisms...)
+	addInitialisms(extra...)
+}
+
+// addInitialisms adds project-specific initialisms, such as "GRPC", to the
+// ones option names spell in all caps.
+func addInitialisms(words ...string) {
+	for _, word := range words {
+		if word = strings.TrimSpace(word); word != "" {
+			initialisms[strings.ToUpper(word)] = true
+		}
+	}
+}
+
+// splitWords splits an identifier or phrase into its words, at separators,
+// at lower to upper case changes and before the last upper case letter of
+// a run followed by lower case, so that "HTTPServer" is "HTTP" "Server". An
+// initialism followed by a plural s, as in "IDs", stays one word.
+func splitWords(s string) []string {
+	var words []string
+	for _, chunk := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == '_' || r == '-' || r == '.' || unicode.IsSpace(r)
+	}) {
+		runes := []rune(chunk)
+		start := 0
+		for i := 1; i < len(runes); i++ {
+			prev, cur := runes[i-1], runes[i]
+			switch {
+			case unicode.IsLower(prev) && unicode.IsUpper(cur):
+			case unicode.IsDigit(prev) && unicode.IsUpper(cur) && i+1 < len(runes) && unicode.IsLower(runes[i+1]):
+			case unicode.IsUpper(prev) && unicode.IsUpper(cur) && i+1 < len(runes) && unicode.IsLower(runes[i+1]):
+				if isPlural(runes[start:], i-start) {
+					continue
+				}
+			default:
+				continue
+			}
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+		words = append(words, string(runes[start:]))
+	}
+	return words
+}
+
+// isPlural reports whether word is an initialism of n letters followed by a
+// plural s, as in "IDs", possibly followed by more words.
+func isPlural(word []rune, n int) bool {
+	if n+1 >= len(word) || word[n+1] != 's' || !initialisms[string(word[:n+1])] {
+		return false
+	}
+	return n+2 == len(word) || !unicode.IsLower(word[n+2])
+}
+
+// startWord spells word as an inner word of a Go identifier: initialisms in
+// all caps, other words with an upper case first letter and the rest as is.
+func startWord(word string) string {
+	upper := strings.ToUpper(word)
+	if initialisms[upper] {
+		return upper
+	}
+	if base, ok := strings.CutSuffix(word, "s"); ok && initialisms[strings.ToUpper(base)] {
+		return strings.ToUpper(base) + "s"
+	}
+	runes := []rune(word)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+// toStartCase spells s as an exported Go identifier, e.g. "userId" as
+// "UserID" and "url" as "URL".
+func toStartCase(s string) string {
+	var b strings.Builder
+	for _, word := range splitWords(s) {
+		b.WriteString(startWord(word))
+	}
+	return b.String()
+}
+
+// toCamelCase spells s as an unexported Go identifier, e.g. "DBConfig" as
+// "dbConfig" and "URL" as "url".
+func toCamelCase(s string) string {
+	words := splitWords(s)
+	if len(words) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	first := words[0]
+	base, _ := strings.CutSuffix(first, "s")
+	switch upper := strings.ToUpper(base); {
+	case initialisms[upper], base == upper:
+		// Initialisms and other all caps words, as in "DBConfig", are
+		// lowered in full.
+		b.WriteString(strings.ToLower(first))
+	default:
+		runes := []rune(first)
+		runes[0] = unicode.ToLower(runes[0])
+		b.WriteString(string(runes))
+	}
+	for _, word := range words[1:] {
+		b.WriteString(startWord(word))
+	}
+	return b.String()
+}
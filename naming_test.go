@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestNaming(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		wantStart string
+		wantCamel string
+	}{
+		{name: "should pass; single word", in: "name", wantStart: "Name", wantCamel: "name"},
+		{name: "should pass; exported", in: "MaxConns", wantStart: "MaxConns", wantCamel: "maxConns"},
+		{name: "should pass; initialism", in: "url", wantStart: "URL", wantCamel: "url"},
+		{name: "should pass; mixed case initialism", in: "Url", wantStart: "URL", wantCamel: "url"},
+		{name: "should pass; trailing initialism", in: "userId", wantStart: "UserID", wantCamel: "userID"},
+		{name: "should pass; spelled initialism", in: "userID", wantStart: "UserID", wantCamel: "userID"},
+		{name: "should pass; leading initialism", in: "HTTPServer", wantStart: "HTTPServer", wantCamel: "httpServer"},
+		{name: "should pass; all caps word", in: "DBConfig", wantStart: "DBConfig", wantCamel: "dbConfig"},
+		{name: "should pass; plural initialism", in: "IDs", wantStart: "IDs", wantCamel: "ids"},
+		{name: "should pass; inner plural initialism", in: "userIDsByName", wantStart: "UserIDsByName", wantCamel: "userIDsByName"},
+		{name: "should pass; separators", in: "json_api-key", wantStart: "JSONAPIKey", wantCamel: "jsonAPIKey"},
+		{name: "should pass; digits", in: "utf8Name", wantStart: "UTF8Name", wantCamel: "utf8Name"},
+		{name: "should pass; single letter", in: "SubX", wantStart: "SubX", wantCamel: "subX"},
+		{name: "should pass; project initialism", in: "grpcAddr", wantStart: "GRPCAddr", wantCamel: "grpcAddr"},
+		{name: "should pass; empty", in: "", wantStart: "", wantCamel: ""},
+	}
+	addInitialisms("grpc")
+	t.Cleanup(func() { resetInitialisms() })
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := toStartCase(tt.in); got != tt.wantStart {
+				t.Errorf("toStartCase(%q) = %q, want %q", tt.in, got, tt.wantStart)
+			}
+			if got := toCamelCase(tt.in); got != tt.wantCamel {
+				t.Errorf("toCamelCase(%q) = %q, want %q", tt.in, got, tt.wantCamel)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// nestedFields describes the options of a field tagged nested, which take
+// the options of the field's struct type instead of a value. The struct must
+// be declared in the package, so that its generated helpers can be called.
+func (p *Package) nestedFields(field *ast.Field, wt withTag, via embedding) ([]Field, error) {
+	for _, part := range wt.parts {
+		if key, _, _ := strings.Cut(part, "="); key != "nested" && key != "required" && key != "name" {
+			return nil, fmt.Errorf("nested fields take no %s", part)
+		}
+	}
+	if _, ok := structTag(field).Lookup("default"); ok {
+		return nil, fmt.Errorf("nested fields take no default")
+	}
+
+	elem, depth := derefType(field.Type)
+	ident, ok := elem.(*ast.Ident)
+	if depth > 1 || !ok || p.Qualifier != "" {
+		return nil, fmt.Errorf("nested needs a field of a struct type of the package or a pointer to one")
+	}
+	ts, ok := p.Types[ident.Name]
+	if !ok || ts.TypeParams != nil {
+		return nil, fmt.Errorf("nested needs a field of a struct type of the package or a pointer to one")
+	}
+	if _, ok := ts.Type.(*ast.StructType); !ok {
+		return nil, fmt.Errorf("nested needs a field of a struct type of the package or a pointer to one")
+	}
+
+	var fields []Field
+	for _, name := range field.Names {
+		fields = append(fields, Field{
+			Name:      name.Name,
+			Path:      via.path + name.Name,
+			OptName:   name.Name,
+			Type:      p.render(field.Type),
+			Param:     p.render(field.Type),
+			Imports:   via.imports,
+			Required:  wt.flags["required"],
+			Nested:    ident.Name,
+			NestedPtr: depth == 1,
+
+			depth:  via.depth,
+			allocs: via.allocs,
+			pos:    field.Pos(),
+		})
+	}
+	return fields, nil
+}
+
+// resolveNested looks up the structs the nested fields of structs refer to,
+// which must get options themselves.
+func resolveNested(pkg *Package, byFile map[string][]StructData) error {
+	byName := map[string]StructData{}
+	for _, structs := range byFile {
+		for _, st := range structs {
+			byName[st.Name] = st
+		}
+	}
+	for _, structs := range byFile {
+		for i := range structs {
+			for j, field := range structs[i].Fields {
+				if field.Nested == "" {
+					continue
+				}
+				child, ok := byName[field.Nested]
+				if !ok {
+					return fmt.Errorf("%s: nested struct %s has no options", pkg.Fset.Position(field.pos), field.Nested)
+				}
+				field.NestedOption = child.OptionName
+				field.NestedFieldOption = child.FieldOptionName
+				field.NestedDefaults = child.HasDefaults()
+				field.NestedHasNested = child.HasNested()
+				field.NestedRequired = nestedRequirements(byName, child, field.Path, map[string]bool{structs[i].Name: true})
+				structs[i].Fields[j] = field
+			}
+		}
+	}
+	return nil
+}
+
+// NestedRequirement is a required field of a nested struct, at Path, that
+// must be set once the nested field at If is.
+type NestedRequirement struct {
+	If, Path string
+}
+
+// nestedRequirements returns the required fields of st, nested at path, and
+// of the structs nested in it. seen holds the structs st is nested in,
+// whose fields recursive structs do not require again.
+func nestedRequirements(byName map[string]StructData, st StructData, path string, seen map[string]bool) []NestedRequirement {
+	var reqs []NestedRequirement
+	for _, field := range st.RequiredFields() {
+		reqs = append(reqs, NestedRequirement{If: path, Path: path + "." + field})
+	}
+	seen[st.Name] = true
+	defer delete(seen, st.Name)
+	for _, field := range st.Fields {
+		if child, ok := byName[field.Nested]; ok && !seen[child.Name] {
+			reqs = append(reqs, nestedRequirements(byName, child, path+"."+field.Path, seen)...)
+		}
+	}
+	return reqs
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// generatedComment marks the files genopts generates. Files that carry it
+// but are no longer generated are stale.
+const generatedComment = "// Code generated by generateopts; DO NOT EDIT."
+
+// outputs are the files generated in a run, and the files generated by
+// earlier runs that are no longer generated.
+type outputs struct {
+	files []outputFile
+	stale []string
+
+	// dir receives the generated files instead of the directories of their
+	// packages, and file all the generated code of a package, when set.
+	// Files are not stale then.
+	dir  string
+	file string
+	// stdout makes write print the files.
+	stdout bool
+}
+
+type outputFile struct {
+	path    string
+	content []byte
+}
+
+func (o *outputs) add(path string, content []byte) error {
+	if o.dir != "" {
+		path = filepath.Join(o.dir, filepath.Base(path))
+	}
+	if o.has(path) {
+		return fmt.Errorf("%s: generated for more than one package; use -out with a single package", path)
+	}
+	o.files = append(o.files, outputFile{path: path, content: content})
+	return nil
+}
+
+func (o *outputs) has(path string) bool {
+	for _, f := range o.files {
+		if f.path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// markStale records the files of generated that this run did not generate.
+func (o *outputs) markStale(generated ...string) {
+	if o.dir != "" || o.file != "" {
+		return
+	}
+	for _, path := range generated {
+		if !o.has(path) {
+			o.stale = append(o.stale, path)
+		}
+	}
+}
+
+// write writes the generated files whose content changed and removes the
+// stale ones. With stdout set it prints the generated files instead, each
+// headed by its path when there are several.
+func (o *outputs) write() error {
+	if o.stdout {
+		for _, f := range o.files {
+			if len(o.files) > 1 {
+				fmt.Printf("// %s\n", f.path)
+			}
+			if _, err := os.Stdout.Write(f.content); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, f := range o.files {
+		// Leave unchanged files alone, so that their mtimes and the build
+		// caches keyed on them stay valid.
+		if old, err := os.ReadFile(f.path); err == nil && bytes.Equal(old, f.content) {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(f.path, f.content, 0o644); err != nil {
+			return err
+		}
+	}
+	for _, path := range o.stale {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// check writes a unified diff of the changes write would make to w, and
+// reports whether there are none.
+func (o *outputs) check(w io.Writer) (bool, error) {
+	upToDate := true
+	for _, f := range o.files {
+		old, err := os.ReadFile(f.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, err
+		}
+		if bytes.Equal(old, f.content) {
+			continue
+		}
+		upToDate = false
+		fmt.Fprint(w, unifiedDiff(f.path, f.path+" (generated)", old, f.content))
+	}
+	for _, path := range o.stale {
+		old, err := os.ReadFile(path)
+		if err != nil {
+			return false, err
+		}
+		upToDate = false
+		fmt.Fprintf(w, "%s: stale, its source has no options\n", path)
+		fmt.Fprint(w, unifiedDiff(path, "/dev/null", old, nil))
+	}
+	return upToDate, nil
+}
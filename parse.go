@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+)
+
+// parseString returns the statements that parse the string s into v, of
+// the type param written in file, and the imports they need. They run fail
+// when a value does not parse, with the parse error in err. Scalars and
+// slices of scalars, as comma-separated lists, are supported; for other
+// types parseString returns "".
+func (p *Package) parseString(file *File, param ast.Expr, fail string, scope map[string]bool) (string, []Import, error) {
+	typ, imports, err := p.typeIn(file, param, scope)
+	if err != nil {
+		return "", nil, err
+	}
+	fail = "if err != nil {\n" + fail + "\n}\n"
+
+	if s, ok := p.resolveScalar(file, param); ok {
+		call, pkg, result := s.parseCall("s")
+		if call == "" {
+			return "v := " + convert(typ, result, "s"), imports, nil
+		}
+		imports = append(imports, Import{Path: pkg})
+		return fmt.Sprintf("x, err := %s\n%sv := %s", call, fail, convert(typ, result, "x")), imports, nil
+	}
+
+	elemFile, elem, ok := p.sliceElem(file, param)
+	if !ok {
+		return "", nil, nil
+	}
+	s, ok := p.resolveScalar(elemFile, elem)
+	if !ok {
+		return "", nil, nil
+	}
+	elemType, elemImports, err := p.typeIn(elemFile, elem, scope)
+	if err != nil {
+		return "", nil, err
+	}
+	imports = append(imports, elemImports...)
+	imports = append(imports, Import{Path: "strings"})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "var v %s\nif s != \"\" {\nfor _, e := range strings.Split(s, \",\") {\n", typ)
+	call, pkg, result := s.parseCall("strings.TrimSpace(e)")
+	if call == "" {
+		fmt.Fprintf(&b, "v = append(v, %s)\n", convert(elemType, result, "strings.TrimSpace(e)"))
+	} else {
+		imports = append(imports, Import{Path: pkg})
+		fmt.Fprintf(&b, "x, err := %s\n%sv = append(v, %s)\n", call, fail, convert(elemType, result, "x"))
+	}
+	b.WriteString("}\n}")
+	return b.String(), imports, nil
+}
+
+// parseCall returns the call that parses the string expression in as a value
+// of kind s, the package of the parsing function and the type of the value
+// it returns. Strings need no parsing and get no call.
+func (s scalar) parseCall(in string) (call, pkg, result string) {
+	switch s.Kind {
+	case kindBool:
+		return fmt.Sprintf("strconv.ParseBool(%s)", in), "strconv", "bool"
+	case kindInt:
+		return fmt.Sprintf("strconv.ParseInt(%s, 0, %d)", in, s.Bits), "strconv", "int64"
+	case kindUint:
+		return fmt.Sprintf("strconv.ParseUint(%s, 0, %d)", in, s.Bits), "strconv", "uint64"
+	case kindFloat:
+		return fmt.Sprintf("strconv.ParseFloat(%s, %d)", in, s.Bits), "strconv", "float64"
+	case kindDuration:
+		return fmt.Sprintf("time.ParseDuration(%s)", in), "time", "time.Duration"
+	}
+	return "", "", "string"
+}
+
+// convert returns the expression x, of type from, converted to typ.
+func convert(typ, from, x string) string {
+	if typ == from {
+		return x
+	}
+	return typ + "(" + x + ")"
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Rule is a validation rule of a field, enforced by its option before the
+// value is stored.
+type Rule struct {
+	// Text is the rule as written in the with tag, e.g. "min=1".
+	Text string
+	// Decl is a package-level declaration the rule needs, if any.
+	Decl string
+
+	cond string
+}
+
+// Check returns the condition under which the value v violates the rule.
+func (r Rule) Check(v string) string {
+	return strings.ReplaceAll(r.cond, placeholder, v)
+}
+
+// placeholder stands for the checked value in rule conditions. It cannot
+// appear in the quoted literals of a condition.
+const placeholder = "\x00"
+
+var lenRule = regexp.MustCompile(`^len(<=|>=|==|<|>|=)(\d+)$`)
+
+// parseRules returns the rules among the with tag parts of a field of type
+// expr. varPrefix names the package-level variables the rules declare.
+func (p *Package) parseRules(file *File, expr ast.Expr, parts []string, varPrefix string) ([]Rule, error) {
+	var rules []Rule
+	bounds := map[string]string{}
+	for _, part := range parts {
+		key, value, _ := strings.Cut(part, "=")
+
+		var (
+			rule Rule
+			err  error
+		)
+		switch {
+		case key == "min" || key == "max":
+			rule, err = p.boundRule(file, expr, key, value)
+			bounds[key] = value
+		case key == "oneof":
+			rule, err = p.oneofRule(file, expr, value)
+		case key == "regex":
+			rule, err = p.regexRule(file, expr, value, varPrefix+"Regexp")
+		case key == "nonempty":
+			rule, err = p.nonemptyRule(file, expr)
+		case lenRule.MatchString(part):
+			rule, err = p.lenRule(file, expr, part)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", part, err)
+		}
+		rule.Text = part
+		rules = append(rules, rule)
+	}
+	if lo, hi := bounds["min"], bounds["max"]; lo != "" && hi != "" {
+		s, _ := p.resolveScalar(file, expr)
+		if c, err := s.compare(lo, hi); err == nil && c > 0 {
+			return nil, fmt.Errorf("rules min=%s and max=%s admit no value", lo, hi)
+		}
+	}
+	return rules, nil
+}
+
+// checkDefault reports an error when value, the default of a field of type
+// expr as written in its tags, violates one of the rules among parts. sep
+// separates the elements of slice defaults.
+func (p *Package) checkDefault(file *File, expr ast.Expr, parts []string, value, sep string) error {
+	s, isScalar := p.resolveScalar(file, expr)
+	length := len(value)
+	if !isScalar {
+		length = len(defaultElems(value, sep))
+	}
+	for _, part := range parts {
+		key, arg, _ := strings.Cut(part, "=")
+
+		var (
+			ok  bool
+			err error
+		)
+		switch {
+		case (key == "min" || key == "max") && isScalar:
+			var c int
+			c, err = s.compare(value, arg)
+			ok = key == "min" && c >= 0 || key == "max" && c <= 0
+		case key == "oneof" && isScalar:
+			for _, v := range strings.Split(arg, "|") {
+				c, cerr := s.compare(value, v)
+				if cerr != nil {
+					err = cerr
+					break
+				}
+				if c == 0 {
+					ok = true
+					break
+				}
+			}
+		case key == "regex" && isScalar && s.Kind == kindString:
+			var re *regexp.Regexp
+			if re, err = regexp.Compile(arg); err == nil {
+				ok = re.MatchString(value)
+			}
+		case key == "nonempty":
+			ok = length > 0
+		case lenRule.MatchString(part):
+			m := lenRule.FindStringSubmatch(part)
+			n, _ := strconv.Atoi(m[2])
+			ok = map[string]bool{
+				"<=": length <= n,
+				">=": length >= n,
+				"<":  length < n,
+				">":  length > n,
+				"=":  length == n,
+				"==": length == n,
+			}[m[1]]
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("rule %s: %w", part, err)
+		}
+		if !ok {
+			return fmt.Errorf("default %s violates rule %s", value, part)
+		}
+	}
+	return nil
+}
+
+func (p *Package) boundRule(file *File, expr ast.Expr, key, value string) (Rule, error) {
+	s, ok := p.resolveScalar(file, expr)
+	if !ok || s.Kind == kindString || s.Kind == kindBool {
+		return Rule{}, fmt.Errorf("%s needs a numeric or duration field", key)
+	}
+	lit, err := s.literal(value)
+	if err != nil {
+		return Rule{}, err
+	}
+	op := "<"
+	if key == "max" {
+		op = ">"
+	}
+	return Rule{cond: placeholder + " " + op + " " + lit}, nil
+}
+
+func (p *Package) oneofRule(file *File, expr ast.Expr, value string) (Rule, error) {
+	s, ok := p.resolveScalar(file, expr)
+	if !ok || s.Kind == kindBool {
+		return Rule{}, fmt.Errorf("oneof needs a string, numeric or duration field")
+	}
+	var conds []string
+	for _, v := range strings.Split(value, "|") {
+		lit, err := s.literal(v)
+		if err != nil {
+			return Rule{}, err
+		}
+		conds = append(conds, placeholder+" != "+lit)
+	}
+	return Rule{cond: strings.Join(conds, " && ")}, nil
+}
+
+func (p *Package) regexRule(file *File, expr ast.Expr, value, varName string) (Rule, error) {
+	if s, ok := p.resolveScalar(file, expr); !ok || s.Kind != kindString {
+		return Rule{}, fmt.Errorf("regex needs a string field")
+	}
+	if _, err := regexp.Compile(value); err != nil {
+		return Rule{}, err
+	}
+	return Rule{
+		Decl: varName + " = regexp.MustCompile(" + strconv.Quote(value) + ")",
+		cond: "!" + varName + ".MatchString(string(" + placeholder + "))",
+	}, nil
+}
+
+func (p *Package) nonemptyRule(file *File, expr ast.Expr) (Rule, error) {
+	switch {
+	case p.hasLen(file, expr):
+		return Rule{cond: "len(" + placeholder + ") == 0"}, nil
+	case p.isNilable(file, expr):
+		return Rule{cond: placeholder + " == nil"}, nil
+	}
+	return Rule{}, fmt.Errorf("nonempty needs a string, slice, map, channel, pointer, func or interface field")
+}
+
+func (p *Package) lenRule(file *File, expr ast.Expr, part string) (Rule, error) {
+	if !p.hasLen(file, expr) {
+		return Rule{}, fmt.Errorf("len needs a string, slice, map or channel field")
+	}
+	m := lenRule.FindStringSubmatch(part)
+	// The condition is the negation of the rule.
+	violation := map[string]string{
+		"<=": ">",
+		">=": "<",
+		"<":  ">=",
+		">":  "<=",
+		"=":  "!=",
+		"==": "!=",
+	}[m[1]]
+	return Rule{cond: "len(" + placeholder + ") " + violation + " " + m[2]}, nil
+}
+
+// hasLen reports whether expr is a type the len builtin accepts.
+func (p *Package) hasLen(file *File, expr ast.Expr) bool {
+	if s, ok := p.resolveScalar(file, expr); ok {
+		return s.Kind == kindString
+	}
+	_, expr = p.underlying(file, expr)
+	switch t := expr.(type) {
+	case *ast.ArrayType:
+		return t.Len == nil
+	case *ast.MapType, *ast.ChanType:
+		return true
+	}
+	return false
+}
+
+// isNilable reports whether expr is a pointer, func or interface type.
+func (p *Package) isNilable(file *File, expr ast.Expr) bool {
+	_, expr = p.underlying(file, expr)
+	switch expr.(type) {
+	case *ast.StarExpr, *ast.FuncType, *ast.InterfaceType:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+const rulesSrc = `package p
+
+import "time"
+
+type (
+	Int      int
+	Uint8    uint8
+	Float    float64
+	Duration time.Duration
+	Bool     bool
+	String   string
+	Strings  []string
+	Map      map[string]int
+	Chan     chan int
+	Ptr      *int
+	Func     func()
+	Iface    interface{}
+	Struct   struct{}
+)
+`
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		typ       string
+		parts     []string
+		want      []string
+		wantDecls []string
+		wantErr   bool
+	}{
+		{
+			name:  "should skip parts that are no rules",
+			typ:   "Int",
+			parts: []string{"required", "default=1", "append"},
+		},
+		{
+			name:  "should pass; min and max",
+			typ:   "Int",
+			parts: []string{"min=1", "max=65535"},
+			want:  []string{"min=1: v < 1", "max=65535: v > 65535"},
+		},
+		{
+			name:  "should pass; bound in another base",
+			typ:   "Int",
+			parts: []string{"max=0x10"},
+			want:  []string{"max=0x10: v > 16"},
+		},
+		{
+			name:  "should pass; float bound",
+			typ:   "Float",
+			parts: []string{"min=0.5"},
+			want:  []string{"min=0.5: v < 0.5"},
+		},
+		{
+			name:  "should pass; duration bounds",
+			typ:   "Duration",
+			parts: []string{"min=1s", "max=90m"},
+			want:  []string{"min=1s: v < 1 * time.Second", "max=90m: v > 90 * time.Minute"},
+		},
+		{
+			name:    "should fail; contradictory bounds",
+			typ:     "Int",
+			parts:   []string{"min=5", "max=1"},
+			wantErr: true,
+		},
+		{
+			name:  "should pass; equal bounds",
+			typ:   "Duration",
+			parts: []string{"min=1m", "max=60s"},
+			want:  []string{"min=1m: v < 1 * time.Minute", "max=60s: v > 1 * time.Minute"},
+		},
+		{
+			name:    "should fail; bound out of range",
+			typ:     "Uint8",
+			parts:   []string{"max=256"},
+			wantErr: true,
+		},
+		{
+			name:    "should fail; negative unsigned bound",
+			typ:     "Uint8",
+			parts:   []string{"min=-1"},
+			wantErr: true,
+		},
+		{
+			name:    "should fail; bound of a string",
+			typ:     "String",
+			parts:   []string{"min=1"},
+			wantErr: true,
+		},
+		{
+			name:    "should fail; bound of a bool",
+			typ:     "Bool",
+			parts:   []string{"max=1"},
+			wantErr: true,
+		},
+		{
+			name:  "should pass; oneof strings",
+			typ:   "String",
+			parts: []string{"oneof=debug|info"},
+			want:  []string{`oneof=debug|info: v != "debug" && v != "info"`},
+		},
+		{
+			name:  "should pass; oneof ints",
+			typ:   "Int",
+			parts: []string{"oneof=1|2|3"},
+			want:  []string{"oneof=1|2|3: v != 1 && v != 2 && v != 3"},
+		},
+		{
+			name:    "should fail; oneof value of another kind",
+			typ:     "Int",
+			parts:   []string{"oneof=1|two"},
+			wantErr: true,
+		},
+		{
+			name:    "should fail; oneof of a bool",
+			typ:     "Bool",
+			parts:   []string{"oneof=true"},
+			wantErr: true,
+		},
+		{
+			name:      "should pass; regex",
+			typ:       "String",
+			parts:     []string{"regex=^[a-z]+$"},
+			want:      []string{"regex=^[a-z]+$: !pRegexp.MatchString(string(v))"},
+			wantDecls: []string{`pRegexp = regexp.MustCompile("^[a-z]+$")`},
+		},
+		{
+			name:    "should fail; invalid regex",
+			typ:     "String",
+			parts:   []string{"regex=("},
+			wantErr: true,
+		},
+		{
+			name:    "should fail; regex of an int",
+			typ:     "Int",
+			parts:   []string{"regex=^1$"},
+			wantErr: true,
+		},
+		{
+			name:  "should pass; len bounds negated",
+			typ:   "Strings",
+			parts: []string{"len<=3", "len>=1", "len<4", "len>0"},
+			want:  []string{"len<=3: len(v) > 3", "len>=1: len(v) < 1", "len<4: len(v) >= 4", "len>0: len(v) <= 0"},
+		},
+		{
+			name:  "should pass; len equality negated",
+			typ:   "String",
+			parts: []string{"len=2", "len==2"},
+			want:  []string{"len=2: len(v) != 2", "len==2: len(v) != 2"},
+		},
+		{
+			name:  "should pass; len of a map",
+			typ:   "Map",
+			parts: []string{"len<=8"},
+			want:  []string{"len<=8: len(v) > 8"},
+		},
+		{
+			name:    "should fail; len of an int",
+			typ:     "Int",
+			parts:   []string{"len=1"},
+			wantErr: true,
+		},
+		{
+			name:  "should pass; nonempty of types with a length",
+			typ:   "Chan",
+			parts: []string{"nonempty"},
+			want:  []string{"nonempty: len(v) == 0"},
+		},
+		{
+			name:  "should pass; nonempty string",
+			typ:   "String",
+			parts: []string{"nonempty"},
+			want:  []string{"nonempty: len(v) == 0"},
+		},
+		{
+			name:  "should pass; nonempty pointer",
+			typ:   "Ptr",
+			parts: []string{"nonempty"},
+			want:  []string{"nonempty: v == nil"},
+		},
+		{
+			name:  "should pass; nonempty func",
+			typ:   "Func",
+			parts: []string{"nonempty"},
+			want:  []string{"nonempty: v == nil"},
+		},
+		{
+			name:  "should pass; nonempty interface",
+			typ:   "Iface",
+			parts: []string{"nonempty"},
+			want:  []string{"nonempty: v == nil"},
+		},
+		{
+			name:    "should fail; nonempty struct",
+			typ:     "Struct",
+			parts:   []string{"nonempty"},
+			wantErr: true,
+		},
+		{
+			name:    "should fail; nonempty int",
+			typ:     "Int",
+			parts:   []string{"nonempty"},
+			wantErr: true,
+		},
+	}
+	pkg := loadTestPackage(t, rulesSrc)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := pkg.parseRules(pkg.typeFiles[tt.typ], pkg.Types[tt.typ].Type, tt.parts, "p")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var got, gotDecls []string
+			for _, r := range rules {
+				got = append(got, r.Text+": "+r.Check("v"))
+				if r.Decl != "" {
+					gotDecls = append(gotDecls, r.Decl)
+				}
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("parseRules() = %q, want %q", got, tt.want)
+			}
+			if strings.Join(gotDecls, "\n") != strings.Join(tt.wantDecls, "\n") {
+				t.Errorf("parseRules() decls = %q, want %q", gotDecls, tt.wantDecls)
+			}
+		})
+	}
+}
+
+func TestCheckDefault(t *testing.T) {
+	tests := []struct {
+		name    string
+		typ     string
+		parts   []string
+		value   string
+		sep     string
+		wantErr bool
+	}{
+		{name: "should pass; within bounds", typ: "Int", parts: []string{"min=1", "max=0x10"}, value: "16"},
+		{name: "should fail; below min", typ: "Int", parts: []string{"min=1"}, value: "0", wantErr: true},
+		{name: "should fail; above max", typ: "Duration", parts: []string{"max=1m"}, value: "90s", wantErr: true},
+		{name: "should pass; one of", typ: "String", parts: []string{"oneof=a|b"}, value: "b"},
+		{name: "should fail; none of", typ: "String", parts: []string{"oneof=a|b"}, value: "c", wantErr: true},
+		{name: "should pass; one of in another base", typ: "Uint8", parts: []string{"oneof=1|0x10"}, value: "16"},
+		{name: "should pass; matching regex", typ: "String", parts: []string{"regex=^a{1,3}$"}, value: "aa"},
+		{name: "should fail; regex mismatch", typ: "String", parts: []string{"regex=^a{1,3}$"}, value: "aaaa", wantErr: true},
+		{name: "should fail; empty string", typ: "String", parts: []string{"nonempty"}, value: "", wantErr: true},
+		{name: "should fail; empty slice", typ: "Strings", parts: []string{"nonempty"}, value: "[]", sep: ",", wantErr: true},
+		{name: "should pass; length of a slice", typ: "Strings", parts: []string{"len<=2"}, value: "a|b", sep: "|"},
+		{name: "should fail; length of a slice", typ: "Strings", parts: []string{"len<=2"}, value: "a|b|c", sep: "|", wantErr: true},
+		{name: "should fail; length of a string", typ: "String", parts: []string{"len=2"}, value: "abc", wantErr: true},
+		{name: "should skip parts that are no rules", typ: "Int", parts: []string{"required", "default=0"}, value: "0"},
+	}
+	pkg := loadTestPackage(t, rulesSrc)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := pkg.checkDefault(pkg.typeFiles[tt.typ], pkg.Types[tt.typ].Type, tt.parts, tt.value, tt.sep)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkDefault(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// ruleErrorsSrc is a program whose options fail. The test appends a call of
+// report for each case to main.
+const ruleErrorsSrc = `package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type DB struct {
+	Host string ` + "`with:\"-,nonempty\"`" + `
+	Port int    ` + "`with:\"-,min=1\"`" + `
+}
+
+//genopts:aggregate
+type App struct {
+	Level string ` + "`with:\"-,oneof=debug|info\"`" + `
+	DB    DB     ` + "`with:\"-,nested\"`" + `
+}
+
+// report prints err on one line, followed by the fields its first rule and
+// field errors name.
+func report(_ any, err error) {
+	line := strings.ReplaceAll(fmt.Sprint(err), "\n", "; ")
+	var re *RuleError
+	if errors.As(err, &re) {
+		line += " [rule " + re.Struct + "." + re.Field + "]"
+	}
+	var fe *FieldError
+	if errors.As(err, &fe) {
+		line += " [field " + fe.Field + "]"
+	}
+	fmt.Println(line)
+}
+
+func main() {
+`
+
+func TestRuleErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		call string
+		want string
+	}{
+		{
+			name: "should pass; valid options",
+			call: `NewApp(WithLevel("info"), WithDB(WithHost("db"), WithPort(5432)))`,
+			want: "<nil>",
+		},
+		{
+			name: "should pass; rule of the struct",
+			call: `NewDB(WithPort(0))`,
+			want: "DB.Port: value 0 violates rule min=1 [rule DB.Port]",
+		},
+		{
+			name: "should pass; rule named once by the aggregated error",
+			call: `NewApp(WithLevel("trace"))`,
+			want: `App.Level: value "trace" violates rule oneof=debug|info [rule App.Level] [field Level]`,
+		},
+		{
+			name: "should pass; rule of a nested struct",
+			call: `NewApp(WithDB(WithPort(0)))`,
+			want: "App.DB.Port: value 0 violates rule min=1 [rule App.DB.Port] [field DB]",
+		},
+		{
+			name: "should pass; aggregated rules",
+			call: `NewApp(WithLevel("trace"), WithDB(WithHost(""), WithPort(0)))`,
+			want: `App.Level: value "trace" violates rule oneof=debug|info; App.DB.Host: value "" violates rule nonempty [rule App.Level] [field Level]`,
+		},
+		{
+			name: "should pass; error of a nested option",
+			call: `NewApp(WithDB(dbOptionFunc(func(*DB) error { return errors.New("failed") })))`,
+			want: "DB: failed [field DB]",
+		},
+	}
+
+	if testing.Short() {
+		t.Skip("runs the go command")
+	}
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go command")
+	}
+
+	var src strings.Builder
+	src.WriteString(ruleErrorsSrc)
+	for _, tt := range tests {
+		src.WriteString("\treport(" + tt.call + ")\n")
+	}
+	src.WriteString("}\n")
+	dir := writeTestFiles(t, map[string]string{
+		"go.mod":  "module ruleerrors\n\ngo 1.23\n",
+		"main.go": src.String(),
+	})
+	if err := generateTestPackage(t, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(goCmd, "run", ".")
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s", err, output)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
+	if len(lines) != len(tests) {
+		t.Fatalf("go run printed %d lines, want %d:\n%s", len(lines), len(tests), output)
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if lines[i] != tt.want {
+				t.Errorf("%s = %q, want %q", tt.call, lines[i], tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// withTag is the parsed with tag of a struct field. The tag follows the
+// conventions of reflect.StructTag and has the grammar
+//
+//	with:"name[,element]..."
+//	element = flag | key=value | key='value' | lenrule
+//
+// name is the name of the field in its option names, as in with:"Timeout"
+// for WithTimeout, or "-" for the name of the field. It may be left out when
+// the first element is a key=value one. The flags are the modifiers
+// required, append, ptr, value and nested, and the rule nonempty. The
+// key=value elements are the params default and name, which names the
+// option function as is, as in name=UseTimeout, and the rules min, max,
+// oneof and regex. Values that contain commas are quoted in single quotes,
+// as in regex='^a{1,3}$'; a quoted value ends at the first quote followed by
+// a comma or the end of the tag. lenrule compares the length of the value,
+// as in len<=64 or len>0.
+type withTag struct {
+	// name is the first element of the tag, "-" for the default name.
+	name string
+	// parts are the elements after the name, in tag order.
+	parts  []string
+	flags  map[string]bool
+	params map[string]string
+}
+
+var (
+	withFlags  = map[string]bool{"required": true, "append": true, "ptr": true, "value": true, "nested": true, "nonempty": true}
+	withParams = map[string]bool{"default": true, "name": true, "min": true, "max": true, "oneof": true, "regex": true}
+)
+
+// lookupWithTag returns the with tag of field and whether it has one. It
+// fails when the tag does not follow the grammar of withTag, or when the
+// field's tag is malformed around a with key.
+func lookupWithTag(field *ast.Field, key string) (withTag, bool, error) {
+	raw := structTag(field)
+	if err := checkStructTag(string(raw)); err != nil {
+		if strings.Contains(string(raw), key+":") {
+			return withTag{}, false, err
+		}
+		// Malformed tags that do not mention genopts belong to other tools.
+		return withTag{}, false, nil
+	}
+	tag, ok := raw.Lookup(key)
+	if !ok {
+		return withTag{}, false, nil
+	}
+
+	parts, err := splitWithTag(tag)
+	if err != nil {
+		return withTag{}, false, err
+	}
+	if strings.Contains(parts[0], "=") {
+		parts = append([]string{"-"}, parts...)
+	}
+	wt := withTag{name: parts[0], parts: parts[1:], flags: map[string]bool{}, params: map[string]string{}}
+	if wt.name != "-" && !token.IsIdentifier(wt.name) {
+		return withTag{}, false, fmt.Errorf("with tag: option name %q is neither - nor an identifier", wt.name)
+	}
+	for i, part := range wt.parts {
+		key, value, hasValue := strings.Cut(part, "=")
+		switch {
+		case part == "":
+			return withTag{}, false, fmt.Errorf("with tag: empty element")
+		case lenRule.MatchString(part):
+			// Rules are parsed once the field type is known.
+		case hasValue && withParams[key]:
+			if _, dup := wt.params[key]; dup {
+				return withTag{}, false, fmt.Errorf("with tag: %s given twice", key)
+			}
+			wt.params[key] = value
+		case !hasValue && withFlags[key]:
+			wt.flags[key] = true
+		case withParams[key]:
+			return withTag{}, false, fmt.Errorf("with tag: %s needs a value, as in %s=...", key, key)
+		case withFlags[key]:
+			return withTag{}, false, fmt.Errorf("with tag: %s takes no value", key)
+		case i > 0 && strings.Contains(wt.parts[i-1], "="):
+			return withTag{}, false, fmt.Errorf("with tag: unknown element %q; quote values that contain commas, as in regex='^a{1,3}$'", part)
+		default:
+			return withTag{}, false, fmt.Errorf("with tag: unknown element %q", part)
+		}
+	}
+	if name, ok := wt.params["name"]; ok && !token.IsIdentifier(name) {
+		return withTag{}, false, fmt.Errorf("with tag: option name %q is not an identifier", name)
+	}
+	if wt.flags["ptr"] && wt.flags["value"] {
+		return withTag{}, false, fmt.Errorf("with tag: ptr and value exclude each other")
+	}
+	return wt, true, nil
+}
+
+// splitWithTag splits the value of a with tag into its elements at the
+// commas outside single-quoted values, and unquotes those.
+func splitWithTag(tag string) ([]string, error) {
+	var parts []string
+	for {
+		comma := strings.IndexByte(tag, ',')
+		if key, value, ok := strings.Cut(tag, "='"); ok && (comma < 0 || len(key) < comma) {
+			end := strings.Index(value, "',")
+			if end < 0 {
+				if !strings.HasSuffix(value, "'") {
+					return nil, fmt.Errorf("with tag: unterminated quoted value of %s", key)
+				}
+				return append(parts, key+"="+strings.TrimSuffix(value, "'")), nil
+			}
+			parts = append(parts, key+"="+value[:end])
+			tag = value[end+2:]
+			continue
+		}
+		if comma < 0 {
+			return append(parts, tag), nil
+		}
+		parts = append(parts, tag[:comma])
+		tag = tag[comma+1:]
+	}
+}
+
+// rename applies the option names the tag chooses to the options of its
+// field.
+func (wt withTag) rename(fields []Field) ([]Field, error) {
+	funcName := wt.params["name"]
+	if wt.name == "-" && funcName == "" {
+		return fields, nil
+	}
+	if len(fields) > 1 {
+		return nil, fmt.Errorf("with tag: option names need a field declaring a single name")
+	}
+	if wt.name != "-" {
+		fields[0].OptName = wt.name
+	}
+	fields[0].FuncName = funcName
+	return fields, nil
+}
+
+// checkStructTag reports whether tag follows the conventional format of
+// reflect.StructTag, space-separated key:"value" pairs, which
+// reflect.StructTag.Lookup silently gives up on.
+func checkStructTag(tag string) error {
+	for tag != "" {
+		tag = strings.TrimLeft(tag, " ")
+		if tag == "" {
+			break
+		}
+		i := 0
+		for i < len(tag) && tag[i] > ' ' && tag[i] != ':' && tag[i] != '"' && tag[i] != 0x7f {
+			i++
+		}
+		switch {
+		case i == 0:
+			return fmt.Errorf("bad syntax for struct tag key")
+		case i+1 >= len(tag) || tag[i] != ':':
+			return fmt.Errorf("bad syntax for struct tag pair %s", tag[:i])
+		case tag[i+1] != '"':
+			return fmt.Errorf("bad syntax for struct tag value of %s", tag[:i])
+		}
+		key := tag[:i]
+		tag = tag[i+1:]
+
+		i = 1
+		for i < len(tag) && tag[i] != '"' {
+			if tag[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(tag) {
+			return fmt.Errorf("unterminated struct tag value of %s", key)
+		}
+		if _, err := strconv.Unquote(tag[:i+1]); err != nil {
+			return fmt.Errorf("bad syntax for struct tag value of %s", key)
+		}
+		tag = tag[i+1:]
+	}
+	return nil
+}
+
+// tagPos returns the position of key in the tag of field, or of the tag
+// when it cannot be located.
+func tagPos(field *ast.Field, key string) token.Pos {
+	lit := field.Tag.Value
+	if i := strings.Index(lit, key+":"); i >= 0 && strings.HasPrefix(lit, "`") {
+		return field.Tag.Pos() + token.Pos(i)
+	}
+	return field.Tag.Pos()
+}
+
+// defaultValue returns the default of a field, from either the default
+// param of the with tag or a separate default tag. Slice elements are
+// separated by "|" in the with tag, where commas separate params, and by ","
+// in the default tag.
+func defaultValue(field *ast.Field, wt withTag) (value, sep string, ok bool) {
+	if value, ok := wt.params["default"]; ok {
+		return value, "|", true
+	}
+	if value, ok := structTag(field).Lookup("default"); ok {
+		return value, ",", true
+	}
+	return "", "", false
+}
+
+func structTag(field *ast.Field) reflect.StructTag {
+	if field.Tag == nil {
+		return ""
+	}
+	tag, err := strconv.Unquote(field.Tag.Value)
+	if err != nil {
+		return ""
+	}
+	return reflect.StructTag(tag)
+}
+
+// directivePrefix starts the comment directives genopts reads from doc
+// comments, e.g. "//genopts:aggregate".
+const directivePrefix = "//genopts:"
+
+// hasDirective reports whether doc holds the directive //genopts:name.
+func hasDirective(doc *ast.CommentGroup, name string) bool {
+	if doc == nil {
+		return false
+	}
+	for _, c := range doc.List {
+		if directive, ok := strings.CutPrefix(c.Text, directivePrefix); ok && strings.TrimSpace(directive) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// directiveValue returns the value of the directive //genopts:name=value in
+// doc.
+func directiveValue(doc *ast.CommentGroup, name string) (string, bool) {
+	if doc == nil {
+		return "", false
+	}
+	for _, c := range doc.List {
+		if directive, ok := strings.CutPrefix(c.Text, directivePrefix); ok {
+			if key, value, ok := strings.Cut(strings.TrimSpace(directive), "="); ok && key == name {
+				return value, true
+			}
+		}
+	}
+	return "", false
+}
+
+// typeDoc returns the doc comment of ts, which the parser attaches to the
+// declaration when the type is not declared in a group.
+func typeDoc(decl *ast.GenDecl, ts *ast.TypeSpec) *ast.CommentGroup {
+	if ts.Doc == nil && !decl.Lparen.IsValid() {
+		return decl.Doc
+	}
+	return ts.Doc
+}
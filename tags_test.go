@@ -0,0 +1,132 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestLookupWithTag(t *testing.T) {
+	tests := []struct {
+		name    string
+		tag     string
+		want    withTag
+		wantOK  bool
+		wantErr bool
+	}{
+		{
+			name: "should skip untagged fields",
+			tag:  `json:"name"`,
+		},
+		{
+			name: "should skip other keys ending in with",
+			tag:  `nowith:"-"`,
+		},
+		{
+			name:   "should pass; default name",
+			tag:    `with:"-"`,
+			want:   withTag{name: "-", parts: []string{}, flags: map[string]bool{}, params: map[string]string{}},
+			wantOK: true,
+		},
+		{
+			name: "should pass; flags, params and rules",
+			tag:  `json:"timeout" with:"Timeout,required,default=30s,len<=3,min=1s"`,
+			want: withTag{
+				name:   "Timeout",
+				parts:  []string{"required", "default=30s", "len<=3", "min=1s"},
+				flags:  map[string]bool{"required": true},
+				params: map[string]string{"default": "30s", "min": "1s"},
+			},
+			wantOK: true,
+		},
+		{
+			name:   "should pass; function name without option name",
+			tag:    `with:"name=UseTimeout,default=1s"`,
+			want:   withTag{name: "-", parts: []string{"name=UseTimeout", "default=1s"}, flags: map[string]bool{}, params: map[string]string{"name": "UseTimeout", "default": "1s"}},
+			wantOK: true,
+		},
+		{
+			name:   "should pass; quoted value with commas",
+			tag:    `with:"-,regex='^a{1,3}$',required"`,
+			want:   withTag{name: "-", parts: []string{"regex=^a{1,3}$", "required"}, flags: map[string]bool{"required": true}, params: map[string]string{"regex": "^a{1,3}$"}},
+			wantOK: true,
+		},
+		{
+			name:   "should pass; quoted value last",
+			tag:    `with:"regex='a,b'"`,
+			want:   withTag{name: "-", parts: []string{"regex=a,b"}, flags: map[string]bool{}, params: map[string]string{"regex": "a,b"}},
+			wantOK: true,
+		},
+		{
+			name:    "should fail; unquoted value with commas",
+			tag:     `with:"-,regex=^a{1,3}$"`,
+			wantErr: true,
+		},
+		{
+			name:    "should fail; unterminated quoted value",
+			tag:     `with:"-,regex='^a{1,3}$"`,
+			wantErr: true,
+		},
+		{
+			name:    "should fail; invalid function name",
+			tag:     `with:"-,name=Use-Timeout"`,
+			wantErr: true,
+		},
+		{
+			name:    "should fail; unknown element",
+			tag:     `with:"-,requried"`,
+			wantErr: true,
+		},
+		{
+			name:    "should fail; param without value",
+			tag:     `with:"-,default"`,
+			wantErr: true,
+		},
+		{
+			name:    "should fail; flag with value",
+			tag:     `with:"-,append=true"`,
+			wantErr: true,
+		},
+		{
+			name:    "should fail; empty element",
+			tag:     `with:"-,,required"`,
+			wantErr: true,
+		},
+		{
+			name:    "should fail; repeated param",
+			tag:     `with:"-,min=1,min=2"`,
+			wantErr: true,
+		},
+		{
+			name:    "should fail; invalid name",
+			tag:     `with:"with timeout"`,
+			wantErr: true,
+		},
+		{
+			name:    "should fail; unquoted value",
+			tag:     `json:"name" with:-`,
+			wantErr: true,
+		},
+		{
+			name: "should skip malformed tags of other tools",
+			tag:  `json:name`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			field := &ast.Field{Tag: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(tt.tag)}}
+			got, ok, err := lookupWithTag(field, "with")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("lookupWithTag() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if ok != tt.wantOK {
+				t.Fatalf("lookupWithTag() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lookupWithTag() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}